@@ -1,22 +1,151 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/pedroborgesdev/tunnerse-api/internal/api/config"
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/database"
 	"github.com/pedroborgesdev/tunnerse-api/internal/api/debug"
 	"github.com/pedroborgesdev/tunnerse-api/internal/api/expose"
 	"github.com/pedroborgesdev/tunnerse-api/internal/api/logger"
 	"github.com/pedroborgesdev/tunnerse-api/internal/api/middlewares"
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/repositories"
 	"github.com/pedroborgesdev/tunnerse-api/internal/api/routes"
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/services"
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/sshserver"
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/tracing"
 )
 
+func newAPIKeyRepository() (repositories.APIKeyRepository, error) {
+	switch config.AppConfig.API_KEY_STORE {
+	case "mongo":
+		db, err := database.Mongo()
+		if err != nil {
+			return nil, err
+		}
+		return repositories.NewMongoAPIKeyRepository(context.Background(), db)
+	case "bolt":
+		db, err := database.Bolt()
+		if err != nil {
+			return nil, err
+		}
+		repo, err := repositories.NewBoltAPIKeyRepository(db)
+		if err != nil {
+			return nil, err
+		}
+		// O arquivo de chaves, quando existe, é importado a cada início e substitui as chaves salvas
+		imported, removed, err := repo.Import(context.Background(), config.AppConfig.API_KEY_FILE)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		if err == nil {
+			logger.Log("INFO", "API keys have been imported", []logger.LogDetail{
+				{Key: "file", Value: config.AppConfig.API_KEY_FILE},
+				{Key: "keys", Value: imported},
+				{Key: "removed", Value: removed},
+			})
+		}
+		return repo, nil
+	default:
+		repo, err := repositories.NewFileAPIKeyRepository(config.AppConfig.API_KEY_FILE)
+		if errors.Is(err, os.ErrNotExist) && !config.AppConfig.API_KEY_REQUIRED {
+			return nil, nil
+		}
+		return repo, err
+	}
+}
+
+func newTunnelRepository() (repositories.TunnelRepository, error) {
+	switch config.AppConfig.TUNNEL_STORE {
+	case "mongo":
+		db, err := database.Mongo()
+		if err != nil {
+			return nil, err
+		}
+		return repositories.NewMongoTunnelRepository(context.Background(), db)
+	case "bolt":
+		db, err := database.Bolt()
+		if err != nil {
+			return nil, err
+		}
+		return repositories.NewBoltTunnelRepository(db)
+	default:
+		return repositories.NewMemoryTunnelRepository(), nil
+	}
+}
+
+// newHistoryRepository returns nil for the default memory store, where the
+// history lives only in the ring of each tunnel.
+func newHistoryRepository() (repositories.HistoryRepository, error) {
+	switch config.AppConfig.HISTORY_STORE {
+	case "bolt":
+		db, err := database.Bolt()
+		if err != nil {
+			return nil, err
+		}
+		return repositories.NewBoltHistoryRepository(db)
+	default:
+		return nil, nil
+	}
+}
+
+func newLimiterStore() (middlewares.LimiterStore, error) {
+	switch config.AppConfig.RATE_LIMIT_STORE {
+	case "redis":
+		client, err := database.Redis()
+		if err != nil {
+			return nil, err
+		}
+		return middlewares.NewRedisLimiterStore(client, "tunnerse:ratelimit:"), nil
+	default:
+		return middlewares.NewMemoryLimiterStore(), nil
+	}
+}
+
 func main() {
 	_ = debug.LoadDebugConfig()
 	config.LoadAppConfig()
 
+	if err := logger.Setup(logger.Options{
+		Level:      config.AppConfig.LOG_LEVEL,
+		Format:     config.AppConfig.LOG_FORMAT,
+		File:       config.AppConfig.LOG_FILE,
+		FileFormat: config.AppConfig.LOG_FILE_FORMAT,
+		MaxSize:    int64(config.AppConfig.LOG_MAX_SIZE) * 1024 * 1024,
+		MaxBackups: config.AppConfig.LOG_MAX_BACKUPS,
+		Stdout:     config.AppConfig.LOG_STDOUT,
+	}); err != nil {
+		fmt.Printf("\nFailed to configure logger: %s\n", err.Error())
+		os.Exit(1)
+	}
+	defer logger.Close()
+
+	if config.AppConfig.TRACING_ENABLED {
+		if err := tracing.Setup(tracing.Options{
+			Endpoint:    config.AppConfig.TRACING_ENDPOINT,
+			Headers:     tracing.ParseHeaders(config.AppConfig.TRACING_HEADERS),
+			ServiceName: config.AppConfig.TRACING_SERVICE_NAME,
+			SampleRatio: float64(config.AppConfig.TRACING_SAMPLE_RATE) / 100,
+		}); err != nil {
+			fmt.Printf("\nFailed to start tracing: %s\n", err.Error())
+			os.Exit(1)
+		}
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			tracing.Shutdown(ctx)
+		}()
+	}
+
 	errCh, err := expose.StartExpose()
 	if err != nil {
 		fmt.Printf("\nFailed to start expose: %s\n", err.Error())
@@ -29,16 +158,86 @@ func main() {
 		}
 	}()
 
+	apiKeys, err := newAPIKeyRepository()
+	if err != nil {
+		fmt.Printf("\nFailed to load api keys: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	tunnelRecords, err := newTunnelRepository()
+	if err != nil {
+		fmt.Printf("\nFailed to open tunnel store: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	history, err := newHistoryRepository()
+	if err != nil {
+		fmt.Printf("\nFailed to open history store: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	tunnelService := services.NewTunnelService(apiKeys, tunnelRecords, history)
+	if err := tunnelService.Restore(context.Background()); err != nil {
+		fmt.Printf("\nFailed to restore tunnels: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	limiterStore, err := newLimiterStore()
+	if err != nil {
+		fmt.Printf("\nFailed to start rate limiter: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	if config.AppConfig.SSH_PORT != "" {
+		sshErrCh, err := sshserver.StartSSH(tunnelService)
+		if err != nil {
+			fmt.Printf("\nFailed to start ssh: %s\n", err.Error())
+			os.Exit(1)
+		}
+		go func() {
+			if sshErr := <-sshErrCh; sshErr != nil {
+				fmt.Printf("\nSSH error: %s\n", sshErr.Error())
+				os.Exit(1)
+			}
+		}()
+	}
+
 	logger.Log("INFO", "Application has been started", []logger.LogDetail{})
 
 	gin.SetMode(gin.ReleaseMode)
 	router := gin.Default()
 
+	// O expose roda na mesma máquina e repassa o IP real no X-Forwarded-For
+	if err := router.SetTrustedProxies(strings.Split(config.AppConfig.TRUSTED_PROXIES, ",")); err != nil {
+		fmt.Printf("\nInvalid trusted proxies: %s\n", err.Error())
+		os.Exit(1)
+	}
+
 	router.Use(
 		middlewares.CORSMiddleware(),
 	)
 
-	routes.SetupRoutes(router)
+	routes.SetupRoutes(router, tunnelService, limiterStore)
+
+	server := &http.Server{Addr: ":" + config.AppConfig.HTTPPort, Handler: router.Handler()}
 
-	router.Run(":" + config.AppConfig.HTTPPort)
+	// Ao receber SIGINT ou SIGTERM o servidor para e os defers acima enviam os
+	// spans pendentes e fecham o arquivo de log
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fmt.Printf("\nFailed to start http server: %s\n", err.Error())
+		os.Exit(1)
+	}
+	<-stopped
+	logger.Log("INFO", "Application has been stopped", []logger.LogDetail{})
 }
@@ -11,13 +11,67 @@ import (
 
 type Config struct {
 	HTTPPort string
+	DOMAIN   string // Domínio público usado para montar a URL dos túneis
 
 	SUBDOMAIN     bool
 	WARNS_ON_HTML bool
 
+	TRUSTED_PROXIES string // Proxies cujo X-Forwarded-For é aceito, separados por vírgula
+
 	TUNNEL_LIFE_TIME            int
 	TUNNEL_INACTIVITY_LIFE_TIME int
 	TUNNEL_REQUEST_TIMEOUT      int // Timeout para requisições através do túnel (em segundos)
+
+	TCP_PORT_MIN int // Faixa de portas públicas para túneis tcp
+	TCP_PORT_MAX int
+
+	UDP_PORT_MIN        int // Faixa de portas públicas para túneis udp
+	UDP_PORT_MAX        int
+	UDP_SESSION_TIMEOUT int // Inatividade máxima de uma sessão udp (em segundos)
+
+	SSH_PORT     string // Vazio desativa o frontend ssh -R
+	SSH_HOST_KEY string
+
+	MONGO_URI      string
+	MONGO_DATABASE string
+
+	API_KEY_REQUIRED bool   // Exige Tunnerse-Api-Key no /register
+	API_KEY_STORE    string // file, mongo ou bolt
+	API_KEY_FILE     string
+
+	TUNNEL_STORE string // memory, mongo ou bolt, onde os túneis sobrevivem a reinícios
+	BOLT_PATH    string // Arquivo do banco embutido
+
+	HISTORY_SIZE       int    // Trocas guardadas por túnel, 0 desativa
+	HISTORY_BODY_LIMIT int    // Bytes de cada body mantidos no histórico
+	HISTORY_STORE      string // memory ou bolt
+	HAR_IMPORT_LIMIT   int    // Tamanho máximo de um arquivo HAR importado (em bytes)
+
+	RATE_LIMIT_STORE    string // memory ou redis, compartilhado entre instâncias
+	RATE_LIMIT_WINDOW   int    // Janela de recarga dos baldes (em segundos)
+	RATE_LIMIT_IP       int    // Requisições públicas por ip na janela, 0 desativa
+	RATE_LIMIT_TUNNEL   int    // Requisições públicas por túnel na janela
+	RATE_LIMIT_REGISTER int    // Registros por ip na janela
+	RATE_LIMIT_API_KEY  int    // Registros por api key na janela
+
+	REDIS_URL string
+
+	METRICS_ENABLED bool   // Expõe /metrics no formato do Prometheus, desligado por padrão
+	METRICS_TOKEN   string // Bearer exigido no /metrics, vazio deixa aberto
+
+	LOG_LEVEL       string // DEBUG, INFO, WARN ou ERROR; vazio segue a flag DEBUG
+	LOG_FORMAT      string // console, text ou json
+	LOG_FILE        string // Arquivo de log com rotação, vazio desativa
+	LOG_FILE_FORMAT string // Formato do arquivo, json por padrão
+	LOG_MAX_SIZE    int    // Tamanho que dispara a rotação (em MB)
+	LOG_MAX_BACKUPS int    // Arquivos rotacionados mantidos
+	LOG_STDOUT      bool   // Mantém o terminal junto com o arquivo
+
+	TRACING_ENABLED      bool   // Exporta spans via OTLP/HTTP
+	TRACING_ENDPOINT     string // URL do coletor, incluindo /v1/traces
+	TRACING_HEADERS      string // Cabeçalhos do coletor no formato chave=valor,chave=valor
+	TRACING_SERVICE_NAME string
+	TRACING_SAMPLE_RATE  int // Porcentagem dos traces novos exportados
 }
 
 var AppConfig Config
@@ -33,13 +87,67 @@ func LoadAppConfig() error {
 
 	AppConfig = Config{
 		HTTPPort: getEnvStr("HTTPPort", "8080"),
+		DOMAIN:   getEnvStr("DOMAIN", "tunnerse.com"),
 
 		SUBDOMAIN:     getEnvBool("SUBDOMAIN", false),
 		WARNS_ON_HTML: getEnvBool("WARNS_ON_HTML", true),
 
+		TRUSTED_PROXIES: getEnvStr("TRUSTED_PROXIES", "127.0.0.1,::1"),
+
 		TUNNEL_LIFE_TIME:            getEnvInt("TUNNEL_LIFE_TIME", 86400),
 		TUNNEL_INACTIVITY_LIFE_TIME: getEnvInt("TUNNEL_INACTIVITY_LIFE_TIME", 86400),
 		TUNNEL_REQUEST_TIMEOUT:      getEnvInt("TUNNEL_REQUEST_TIMEOUT", 30), // 30 segundos padrão
+
+		TCP_PORT_MIN: getEnvInt("TCP_PORT_MIN", 20000),
+		TCP_PORT_MAX: getEnvInt("TCP_PORT_MAX", 20999),
+
+		UDP_PORT_MIN:        getEnvInt("UDP_PORT_MIN", 21000),
+		UDP_PORT_MAX:        getEnvInt("UDP_PORT_MAX", 21999),
+		UDP_SESSION_TIMEOUT: getEnvInt("UDP_SESSION_TIMEOUT", 60),
+
+		SSH_PORT:     getEnvStr("SSH_PORT", ""),
+		SSH_HOST_KEY: getEnvStr("SSH_HOST_KEY", "certs/ssh_host_ed25519_key"),
+
+		MONGO_URI:      getEnvStr("MONGO_URI", "mongodb://localhost:27017"),
+		MONGO_DATABASE: getEnvStr("MONGO_DATABASE", "tunnerse"),
+
+		API_KEY_REQUIRED: getEnvBool("API_KEY_REQUIRED", false),
+		API_KEY_STORE:    getEnvStr("API_KEY_STORE", "file"),
+		API_KEY_FILE:     getEnvStr("API_KEY_FILE", "apikeys.json"),
+
+		TUNNEL_STORE: getEnvStr("TUNNEL_STORE", "memory"),
+		BOLT_PATH:    getEnvStr("BOLT_PATH", "data/tunnerse.db"),
+
+		HISTORY_SIZE:       getEnvInt("HISTORY_SIZE", 100),
+		HISTORY_BODY_LIMIT: getEnvInt("HISTORY_BODY_LIMIT", 64*1024),
+		HISTORY_STORE:      getEnvStr("HISTORY_STORE", "memory"),
+		HAR_IMPORT_LIMIT:   getEnvInt("HAR_IMPORT_LIMIT", 16*1024*1024),
+
+		RATE_LIMIT_STORE:    getEnvStr("RATE_LIMIT_STORE", "memory"),
+		RATE_LIMIT_WINDOW:   getEnvInt("RATE_LIMIT_WINDOW", 60),
+		RATE_LIMIT_IP:       getEnvInt("RATE_LIMIT_IP", 600),
+		RATE_LIMIT_TUNNEL:   getEnvInt("RATE_LIMIT_TUNNEL", 3000),
+		RATE_LIMIT_REGISTER: getEnvInt("RATE_LIMIT_REGISTER", 10),
+		RATE_LIMIT_API_KEY:  getEnvInt("RATE_LIMIT_API_KEY", 30),
+
+		REDIS_URL: getEnvStr("REDIS_URL", "redis://localhost:6379/0"),
+
+		METRICS_ENABLED: getEnvBool("METRICS_ENABLED", false),
+		METRICS_TOKEN:   getEnvStr("METRICS_TOKEN", ""),
+
+		LOG_LEVEL:       getEnvStr("LOG_LEVEL", ""),
+		LOG_FORMAT:      getEnvStr("LOG_FORMAT", "console"),
+		LOG_FILE:        getEnvStr("LOG_FILE", ""),
+		LOG_FILE_FORMAT: getEnvStr("LOG_FILE_FORMAT", "json"),
+		LOG_MAX_SIZE:    getEnvInt("LOG_MAX_SIZE", 100),
+		LOG_MAX_BACKUPS: getEnvInt("LOG_MAX_BACKUPS", 5),
+		LOG_STDOUT:      getEnvBool("LOG_STDOUT", true),
+
+		TRACING_ENABLED:      getEnvBool("TRACING_ENABLED", false),
+		TRACING_ENDPOINT:     getEnvStr("TRACING_ENDPOINT", "http://localhost:4318/v1/traces"),
+		TRACING_HEADERS:      getEnvStr("TRACING_HEADERS", ""),
+		TRACING_SERVICE_NAME: getEnvStr("TRACING_SERVICE_NAME", "tunnerse-api"),
+		TRACING_SAMPLE_RATE:  getEnvInt("TRACING_SAMPLE_RATE", 100),
 	}
 
 	logger.Log("ENV", "Defined environment variables", []logger.LogDetail{
@@ -0,0 +1,40 @@
+package controllers
+
+import (
+	"crypto/subtle"
+
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/config"
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/logger"
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/metrics"
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type MetricsController struct{}
+
+func NewMetricsController() *MetricsController {
+	return &MetricsController{}
+}
+
+// Metrics renders the Prometheus exposition. Requests for a tunnel host are
+// left to the next handlers, so /metrics of a tunneled app keeps working in
+// subdomain mode.
+func (c *MetricsController) Metrics(ctx *gin.Context) {
+	if config.AppConfig.SUBDOMAIN && utils.GetTunnelName(ctx) != "" {
+		return
+	}
+	defer ctx.Abort()
+
+	if token := config.AppConfig.METRICS_TOKEN; token != "" {
+		if subtle.ConstantTimeCompare([]byte(utils.BearerToken(ctx)), []byte(token)) != 1 {
+			utils.Unauthorized(ctx, gin.H{"error": "unauthorized"})
+			logger.Log("WARN", "Unauthorized metrics access", []logger.LogDetail{
+				{Key: "ip", Value: ctx.ClientIP()},
+			})
+			return
+		}
+	}
+
+	metrics.Handler().ServeHTTP(ctx.Writer, ctx.Request)
+}
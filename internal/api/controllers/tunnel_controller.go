@@ -1,12 +1,15 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/pedroborgesdev/tunnerse-api/internal/api/config"
 	"github.com/pedroborgesdev/tunnerse-api/internal/api/logger"
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/models"
 	"github.com/pedroborgesdev/tunnerse-api/internal/api/services"
 	"github.com/pedroborgesdev/tunnerse-api/internal/api/utils"
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/validation"
 
 	"github.com/gin-gonic/gin"
 )
@@ -15,9 +18,9 @@ type TunnelController struct {
 	tunnelService *services.TunnelService
 }
 
-func NewTunnelController() *TunnelController {
+func NewTunnelController(tunnelService *services.TunnelService) *TunnelController {
 	return &TunnelController{
-		tunnelService: services.NewTunnelService(),
+		tunnelService: tunnelService,
 	}
 }
 
@@ -29,6 +32,33 @@ func (c *TunnelController) respondNoTunnel(ctx *gin.Context) {
 	utils.Success(ctx, gin.H{"message": "Tunnerse is running :)"})
 }
 
+// authorize rejects agent-side calls that do not present the tunnel secret
+// issued by Register.
+func (c *TunnelController) authorize(ctx *gin.Context, name string) bool {
+	err := c.tunnelService.Authorize(name, utils.BearerToken(ctx))
+	if err == nil {
+		return true
+	}
+
+	if err.Error() == "tunnel not found" {
+		if config.AppConfig.WARNS_ON_HTML {
+			c.tunnelService.NotFound(ctx.Writer)
+			ctx.Abort()
+			return false
+		}
+		utils.BadRequest(ctx, gin.H{"error": err.Error()})
+		return false
+	}
+
+	utils.Unauthorized(ctx, gin.H{"error": err.Error()})
+	logger.Log("WARN", "Unauthorized tunnel access", []logger.LogDetail{
+		{Key: "tunnel", Value: name},
+		{Key: "ip", Value: ctx.ClientIP()},
+		{Key: "path", Value: ctx.Request.URL.Path},
+	})
+	return false
+}
+
 func (c *TunnelController) Register(ctx *gin.Context) {
 	var req utils.RegisterRequest
 	if err := ctx.ShouldBindJSON(&req); err != nil {
@@ -36,8 +66,43 @@ func (c *TunnelController) Register(ctx *gin.Context) {
 		return
 	}
 
-	tunnelName, err := c.tunnelService.Register(req.Name)
+	apiKey, err := c.tunnelService.Authenticate(ctx.Request.Context(), ctx.GetHeader("Tunnerse-Api-Key"))
 	if err != nil {
+		utils.Unauthorized(ctx, gin.H{"error": err.Error()})
+		logger.Log("WARN", "Registration rejected", []logger.LogDetail{
+			{Key: "ip", Value: ctx.ClientIP()},
+			{Key: "Error", Value: err.Error()},
+		})
+		return
+	}
+
+	options := models.TunnelOptions{
+		Type:   req.Type,
+		Stream: req.Stream,
+		Allow:  req.Allow,
+		Deny:   req.Deny,
+	}
+	if req.Auth != nil {
+		options.Auth = &models.TunnelAuth{Username: req.Auth.Username}
+		if req.Auth.Password != "" {
+			hash, err := utils.HashPassword(req.Auth.Password)
+			if err != nil {
+				utils.BadRequest(ctx, gin.H{"error": "invalid auth password: " + err.Error()})
+				return
+			}
+			options.Auth.PasswordHash = hash
+		}
+		if req.Auth.Token != "" {
+			options.Auth.TokenHash = utils.HashSecret(req.Auth.Token)
+		}
+	}
+
+	tunnel, err := c.tunnelService.Register(req.Name, options, apiKey)
+	if err != nil {
+		if errors.Is(err, validation.ErrNameNotAllowed) || errors.Is(err, validation.ErrTunnelLimit) {
+			utils.Forbidden(ctx, gin.H{"error": err.Error()})
+			return
+		}
 		if config.AppConfig.WARNS_ON_HTML && err.Error() == "tunnel not found" {
 			c.tunnelService.NotFound(ctx.Writer)
 			return
@@ -47,14 +112,27 @@ func (c *TunnelController) Register(ctx *gin.Context) {
 		return
 	}
 
-	utils.Success(ctx, gin.H{
+	data := gin.H{
 		"message":   "tunnel has been registered",
 		"subdomain": config.AppConfig.SUBDOMAIN,
-		"tunnel":    tunnelName,
-	})
+		"tunnel":    tunnel.Name,
+		"secret":    tunnel.Secret,
+		"type":      tunnel.Options.Type,
+		"stream":    tunnel.Options.Stream,
+		"protected": tunnel.Options.Auth != nil,
+	}
+	if tunnel.Port != 0 {
+		data["port"] = tunnel.Port
+	} else {
+		data["url"] = utils.TunnelURL(tunnel.Name)
+	}
+
+	utils.Success(ctx, data)
 	logger.Log("INFO", "User registered successfully", []logger.LogDetail{
 		{Key: "subdomain", Value: config.AppConfig.SUBDOMAIN},
-		{Key: "tunnel", Value: tunnelName},
+		{Key: "tunnel", Value: tunnel.Name},
+		{Key: "type", Value: tunnel.Options.Type},
+		{Key: "owner", Value: tunnel.Owner},
 	})
 }
 
@@ -64,6 +142,9 @@ func (c *TunnelController) Get(ctx *gin.Context) {
 		c.respondNoTunnel(ctx)
 		return
 	}
+	if !c.authorize(ctx, name) {
+		return
+	}
 
 	body, err := c.tunnelService.Get(name, ctx.Request)
 	if err != nil {
@@ -86,6 +167,9 @@ func (c *TunnelController) Response(ctx *gin.Context) {
 		c.respondNoTunnel(ctx)
 		return
 	}
+	if !c.authorize(ctx, name) {
+		return
+	}
 
 	err := c.tunnelService.Response(name, ctx.Request.Body)
 	if err != nil {
@@ -109,7 +193,7 @@ func (c *TunnelController) Tunnel(ctx *gin.Context) {
 		return
 	}
 
-	err := c.tunnelService.Tunnel(name, ctx.Request.URL.Path, ctx.Writer, ctx.Request)
+	err := c.tunnelService.Tunnel(name, ctx.Request.URL.Path, ctx.ClientIP(), ctx.Writer, ctx.Request)
 	if err != nil {
 		if config.AppConfig.WARNS_ON_HTML {
 			switch err.Error() {
@@ -119,19 +203,263 @@ func (c *TunnelController) Tunnel(ctx *gin.Context) {
 				c.tunnelService.Timeout(ctx.Writer)
 			case "local-api-error":
 				c.tunnelService.LocalError(ctx.Writer)
+			case "unauthorized":
+				c.tunnelService.Unauthorized(ctx.Writer)
+			case "forbidden":
+				c.tunnelService.Forbidden(ctx.Writer)
 			default:
 				ctx.String(http.StatusInternalServerError, err.Error())
 			}
 			return
 		}
+		if err.Error() == "unauthorized" {
+			utils.Unauthorized(ctx, gin.H{"error": err.Error()})
+			return
+		}
+		if err.Error() == "forbidden" {
+			utils.Forbidden(ctx, gin.H{"error": err.Error()})
+			return
+		}
 		utils.BadRequest(ctx, gin.H{"error": err.Error()})
 		logger.Log("ERROR", "Tunneling failed", []logger.LogDetail{{Key: "Error", Value: err.Error()}})
 		return
 	}
+}
+
+func (c *TunnelController) Connect(ctx *gin.Context) {
+	name := utils.GetTunnelName(ctx)
+	if name == "" {
+		c.respondNoTunnel(ctx)
+		return
+	}
+	if !c.authorize(ctx, name) {
+		return
+	}
+
+	err := c.tunnelService.Connect(name, ctx.Writer, ctx.Request)
+	if err != nil {
+		if config.AppConfig.WARNS_ON_HTML && err.Error() == "tunnel not found" {
+			c.tunnelService.NotFound(ctx.Writer)
+			return
+		}
+		utils.BadRequest(ctx, gin.H{"error": err.Error()})
+		logger.Log("ERROR", "Agent connection failed", []logger.LogDetail{{Key: "Error", Value: err.Error()}})
+		return
+	}
+
+	logger.Log("INFO", "Agent has been connected", []logger.LogDetail{{Key: "tunnel", Value: name}})
+}
+
+func (c *TunnelController) Stream(ctx *gin.Context) {
+	name := utils.GetTunnelName(ctx)
+	if name == "" {
+		c.respondNoTunnel(ctx)
+		return
+	}
+	if !c.authorize(ctx, name) {
+		return
+	}
 
-	logger.Log("INFO", "Message has been written", []logger.LogDetail{
+	token := ctx.GetHeader("Tunnerse-Request-Token")
+	err := c.tunnelService.Stream(name, token, ctx.Writer, ctx.Request)
+	if err != nil {
+		if config.AppConfig.WARNS_ON_HTML && err.Error() == "tunnel not found" {
+			c.tunnelService.NotFound(ctx.Writer)
+			return
+		}
+		// Depois do hijack a conexão já foi fechada pelo serviço
+		if !ctx.Writer.Written() {
+			utils.BadRequest(ctx, gin.H{"error": err.Error()})
+		}
+		logger.Log("ERROR", "Stream failed", []logger.LogDetail{{Key: "Error", Value: err.Error()}})
+		return
+	}
+
+	logger.Log("INFO", "Stream has been attached", []logger.LogDetail{
 		{Key: "tunnel", Value: name},
-		{Key: "path", Value: ctx.Request.URL.Path},
+		{Key: "token", Value: token},
+	})
+}
+
+func (c *TunnelController) Stats(ctx *gin.Context) {
+	name := utils.GetTunnelName(ctx)
+	if name == "" {
+		c.respondNoTunnel(ctx)
+		return
+	}
+	if !c.authorize(ctx, name) {
+		return
+	}
+
+	stats, err := c.tunnelService.Stats(name)
+	if err != nil {
+		if config.AppConfig.WARNS_ON_HTML && err.Error() == "tunnel not found" {
+			c.tunnelService.NotFound(ctx.Writer)
+			return
+		}
+		utils.BadRequest(ctx, gin.H{"error": err.Error()})
+		return
+	}
+
+	utils.Success(ctx, stats)
+}
+
+func (c *TunnelController) Requests(ctx *gin.Context) {
+	name := utils.GetTunnelName(ctx)
+	if name == "" {
+		c.respondNoTunnel(ctx)
+		return
+	}
+	if !c.authorize(ctx, name) {
+		return
+	}
+
+	records, err := c.tunnelService.Requests(name)
+	if err != nil {
+		if config.AppConfig.WARNS_ON_HTML && err.Error() == "tunnel not found" {
+			c.tunnelService.NotFound(ctx.Writer)
+			return
+		}
+		utils.BadRequest(ctx, gin.H{"error": err.Error()})
+		return
+	}
+
+	utils.Success(ctx, gin.H{"requests": records})
+}
+
+// Inspector serves the live traffic page. It authenticates from the browser
+// with the tunnel secret, so only the data endpoints are protected.
+func (c *TunnelController) Inspector(ctx *gin.Context) {
+	name := utils.GetTunnelName(ctx)
+	if name == "" {
+		c.respondNoTunnel(ctx)
+		return
+	}
+
+	err := c.tunnelService.Inspector(name, ctx.Writer)
+	if err != nil {
+		if config.AppConfig.WARNS_ON_HTML {
+			c.tunnelService.NotFound(ctx.Writer)
+			return
+		}
+		utils.BadRequest(ctx, gin.H{"error": err.Error()})
+	}
+}
+
+func (c *TunnelController) Watch(ctx *gin.Context) {
+	name := utils.GetTunnelName(ctx)
+	if name == "" {
+		c.respondNoTunnel(ctx)
+		return
+	}
+	if !c.authorize(ctx, name) {
+		return
+	}
+
+	logger.Log("DEBUG", "Inspector has been connected", []logger.LogDetail{
+		{Key: "tunnel", Value: name},
+		{Key: "ip", Value: ctx.ClientIP()},
+	})
+
+	err := c.tunnelService.Watch(name, ctx.Writer, ctx.Request)
+	if err != nil {
+		if config.AppConfig.WARNS_ON_HTML && err.Error() == "tunnel not found" {
+			c.tunnelService.NotFound(ctx.Writer)
+			return
+		}
+		utils.BadRequest(ctx, gin.H{"error": err.Error()})
+	}
+}
+
+func (c *TunnelController) Replay(ctx *gin.Context) {
+	name := utils.GetTunnelName(ctx)
+	if name == "" {
+		c.respondNoTunnel(ctx)
+		return
+	}
+	if !c.authorize(ctx, name) {
+		return
+	}
+
+	record, err := c.tunnelService.Replay(ctx.Request.Context(), name, ctx.Param("id"), ctx.ClientIP())
+	if err != nil {
+		if err.Error() == "request not found" {
+			utils.NotFound(ctx, gin.H{"error": err.Error()})
+			return
+		}
+		utils.BadRequest(ctx, gin.H{"error": err.Error()})
+		logger.Log("ERROR", "Replay failed", []logger.LogDetail{
+			{Key: "tunnel", Value: name},
+			{Key: "Error", Value: err.Error()},
+		})
+		return
+	}
+
+	utils.Success(ctx, gin.H{"request": record})
+	logger.Log("INFO", "Request has been replayed", []logger.LogDetail{
+		{Key: "tunnel", Value: name},
+		{Key: "path", Value: record.Path},
+		{Key: "status", Value: record.Status},
+	})
+}
+
+func (c *TunnelController) ExportHAR(ctx *gin.Context) {
+	name := utils.GetTunnelName(ctx)
+	if name == "" {
+		c.respondNoTunnel(ctx)
+		return
+	}
+	if !c.authorize(ctx, name) {
+		return
+	}
+
+	har, err := c.tunnelService.ExportHAR(name)
+	if err != nil {
+		if config.AppConfig.WARNS_ON_HTML && err.Error() == "tunnel not found" {
+			c.tunnelService.NotFound(ctx.Writer)
+			return
+		}
+		utils.BadRequest(ctx, gin.H{"error": err.Error()})
+		return
+	}
+
+	// O arquivo é entregue cru, sem o envelope das outras respostas
+	ctx.Header("Content-Disposition", `attachment; filename="`+name+`.har"`)
+	ctx.JSON(http.StatusOK, har)
+}
+
+func (c *TunnelController) ImportHAR(ctx *gin.Context) {
+	name := utils.GetTunnelName(ctx)
+	if name == "" {
+		c.respondNoTunnel(ctx)
+		return
+	}
+	if !c.authorize(ctx, name) {
+		return
+	}
+
+	ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, int64(config.AppConfig.HAR_IMPORT_LIMIT))
+	var har models.HAR
+	if err := ctx.ShouldBindJSON(&har); err != nil {
+		utils.BadRequest(ctx, gin.H{"error": err.Error()})
+		return
+	}
+
+	records, err := c.tunnelService.ImportHAR(ctx.Request.Context(), name, &har, ctx.ClientIP())
+	if err != nil {
+		utils.BadRequest(ctx, gin.H{"error": err.Error(), "requests": records})
+		logger.Log("ERROR", "HAR import failed", []logger.LogDetail{
+			{Key: "tunnel", Value: name},
+			{Key: "replayed", Value: len(records)},
+			{Key: "Error", Value: err.Error()},
+		})
+		return
+	}
+
+	utils.Success(ctx, gin.H{"requests": records})
+	logger.Log("INFO", "HAR has been imported", []logger.LogDetail{
+		{Key: "tunnel", Value: name},
+		{Key: "replayed", Value: len(records)},
 	})
 }
 
@@ -141,6 +469,9 @@ func (c *TunnelController) Close(ctx *gin.Context) {
 		c.respondNoTunnel(ctx)
 		return
 	}
+	if !c.authorize(ctx, name) {
+		return
+	}
 
 	err := c.tunnelService.Close(name)
 	if err != nil {
@@ -0,0 +1,40 @@
+package database
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/config"
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/logger"
+)
+
+var boltDB *bolt.DB
+
+// Bolt opens the embedded database file on first use. Only one process can
+// hold the file at a time.
+func Bolt() (*bolt.DB, error) {
+	if boltDB != nil {
+		return boltDB, nil
+	}
+
+	path := config.AppConfig.BOLT_PATH
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create bolt directory: %w", err)
+	}
+
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bolt database: %w", err)
+	}
+
+	logger.Log("INFO", "Opened embedded database", []logger.LogDetail{
+		{Key: "path", Value: path},
+	})
+
+	boltDB = db
+	return boltDB, nil
+}
@@ -0,0 +1,40 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/config"
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/logger"
+)
+
+var mongoDB *mongo.Database
+
+// Mongo connects on first use and returns the configured database.
+func Mongo() (*mongo.Database, error) {
+	if mongoDB != nil {
+		return mongoDB, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(config.AppConfig.MONGO_URI))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to mongo: %w", err)
+	}
+	if err := client.Ping(ctx, nil); err != nil {
+		return nil, fmt.Errorf("failed to ping mongo: %w", err)
+	}
+
+	logger.Log("INFO", "Connected to MongoDB", []logger.LogDetail{
+		{Key: "database", Value: config.AppConfig.MONGO_DATABASE},
+	})
+
+	mongoDB = client.Database(config.AppConfig.MONGO_DATABASE)
+	return mongoDB, nil
+}
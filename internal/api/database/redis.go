@@ -0,0 +1,42 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/config"
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/logger"
+)
+
+var redisClient *redis.Client
+
+// Redis connects on first use and returns a client for the configured URL.
+func Redis() (*redis.Client, error) {
+	if redisClient != nil {
+		return redisClient, nil
+	}
+
+	opts, err := redis.ParseURL(config.AppConfig.REDIS_URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis url: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client := redis.NewClient(opts)
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to ping redis: %w", err)
+	}
+
+	logger.Log("INFO", "Connected to Redis", []logger.LogDetail{
+		{Key: "addr", Value: opts.Addr},
+	})
+
+	redisClient = client
+	return redisClient, nil
+}
@@ -0,0 +1,514 @@
+package expose
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/acme"
+
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/logger"
+)
+
+const (
+	acmeCheckInterval = 12 * time.Hour
+	acmeRetryInterval = time.Hour
+	acmeOrderTimeout  = 10 * time.Minute
+)
+
+// acmeConfig is the [acme] section of tunnerse.config.
+type acmeConfig struct {
+	Email       string
+	Directory   string        // URL do diretório ACME, troque pelo Pebble em testes
+	DirectoryCA string        // CA extra para confiar no diretório (ex: pebble.minica.pem)
+	Cache       string        // Pasta da conta e dos certificados emitidos
+	Domains     []string      // Vazio usa os domínios de [domains]
+	DNSHook     string        // Comando chamado com present/cleanup para o DNS-01
+	RenewBefore time.Duration // Antecedência da renovação
+}
+
+func defaultACMEConfig() *acmeConfig {
+	return &acmeConfig{
+		Directory:   acme.LetsEncryptURL,
+		Cache:       filepath.Join("certs", "acme"),
+		RenewBefore: 30 * 24 * time.Hour,
+	}
+}
+
+func (c *acmeConfig) set(line string) error {
+	key, value, ok := strings.Cut(line, "=")
+	if !ok {
+		return fmt.Errorf("invalid line on config: %s", line)
+	}
+	key = strings.ToLower(strings.TrimSpace(key))
+	value = strings.TrimSpace(value)
+
+	switch key {
+	case "email":
+		c.Email = value
+	case "directory":
+		c.Directory = value
+	case "directory_ca":
+		c.DirectoryCA = value
+	case "cache":
+		c.Cache = value
+	case "domains":
+		c.Domains = nil
+		for _, domain := range strings.Split(value, ",") {
+			if domain = strings.ToLower(strings.TrimSpace(domain)); domain != "" {
+				c.Domains = append(c.Domains, domain)
+			}
+		}
+	case "dns_hook":
+		c.DNSHook = value
+	case "renew_before":
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid renew_before: %w", err)
+		}
+		c.RenewBefore = d
+	default:
+		return fmt.Errorf("unknown acme option: %s", key)
+	}
+	return nil
+}
+
+func (c *acmeConfig) validate() error {
+	if c.Directory == "" {
+		return fmt.Errorf("acme directory is required")
+	}
+	if c.Cache == "" {
+		return fmt.Errorf("acme cache is required")
+	}
+	for _, domain := range c.Domains {
+		if strings.HasPrefix(domain, "*.") && c.DNSHook == "" {
+			return fmt.Errorf("wildcard %s requires dns_hook for the dns-01 challenge", domain)
+		}
+	}
+	return nil
+}
+
+// certManager issues and renews one certificate covering every configured
+// domain, answering HTTP-01 challenges on the :80 server and DNS-01 ones
+// through the hook command.
+type certManager struct {
+	settings acmeConfig
+	domains  []string
+	client   *acme.Client
+
+	cert     *tls.Certificate
+	tokens   map[string]string // Token do HTTP-01 -> key authorization
+	mu       sync.RWMutex
+	obtainMu sync.Mutex
+}
+
+func newCertManager(settings acmeConfig, domains []string) (*certManager, error) {
+	if len(domains) == 0 {
+		return nil, fmt.Errorf("acme needs at least one domain")
+	}
+	for _, domain := range domains {
+		if strings.HasPrefix(domain, "*.") && settings.DNSHook == "" {
+			return nil, fmt.Errorf("wildcard %s requires dns_hook for the dns-01 challenge", domain)
+		}
+	}
+
+	httpClient := http.DefaultClient
+	if settings.DirectoryCA != "" {
+		data, err := os.ReadFile(settings.DirectoryCA)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read acme directory ca: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificate found in %s", settings.DirectoryCA)
+		}
+		httpClient = &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+	}
+
+	if err := os.MkdirAll(settings.Cache, 0o700); err != nil {
+		return nil, err
+	}
+	accountKey, err := loadOrCreateKey(filepath.Join(settings.Cache, "account.key"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load acme account key: %w", err)
+	}
+
+	m := &certManager{
+		settings: settings,
+		domains:  domains,
+		client: &acme.Client{
+			Key:          accountKey,
+			DirectoryURL: settings.Directory,
+			HTTPClient:   httpClient,
+			UserAgent:    "tunnerse",
+		},
+		tokens: make(map[string]string),
+	}
+
+	if cert, err := tls.LoadX509KeyPair(m.certPath(), m.keyPath()); err == nil {
+		m.cert = &cert
+	}
+	return m, nil
+}
+
+func (m *certManager) certPath() string {
+	return filepath.Join(m.settings.Cache, cacheName(m.domains[0])+".crt")
+}
+
+func (m *certManager) keyPath() string {
+	return filepath.Join(m.settings.Cache, cacheName(m.domains[0])+".key")
+}
+
+// cacheName turns "*.tunnerse.com" into "wildcard.tunnerse.com".
+func cacheName(domain string) string {
+	return strings.Replace(domain, "*", "wildcard", 1)
+}
+
+// GetCertificate serves the current certificate; a renewal replaces it for
+// the next handshakes without restarting the server.
+func (m *certManager) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.cert == nil {
+		return nil, fmt.Errorf("acme certificate is not ready")
+	}
+	return m.cert, nil
+}
+
+// covers reports whether name is one of the domains on the ACME certificate.
+func (m *certManager) covers(name string) bool {
+	for _, domain := range m.domains {
+		if domain == name {
+			return true
+		}
+		if parent, ok := strings.CutPrefix(domain, "*."); ok {
+			if _, rest, ok := strings.Cut(name, "."); ok && rest == parent {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// HTTPHandler answers HTTP-01 challenges and hands everything else to next.
+func (m *certManager) HTTPHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.URL.Path, "/.well-known/acme-challenge/")
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		m.mu.RLock()
+		keyAuth, exists := m.tokens[token]
+		m.mu.RUnlock()
+		if !exists {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(keyAuth))
+	})
+}
+
+// needsRenewal reports whether the certificate is missing, inside the
+// renewal window or does not cover every domain (after a reload added one).
+func (m *certManager) needsRenewal() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.cert == nil || m.cert.Leaf == nil {
+		return true
+	}
+	for _, domain := range m.domains {
+		if m.cert.Leaf.VerifyHostname(cacheName(domain)) != nil {
+			return true
+		}
+	}
+	return time.Until(m.cert.Leaf.NotAfter) < m.settings.RenewBefore
+}
+
+// run keeps the certificate valid until ctx is done.
+func (m *certManager) run(ctx context.Context) {
+	for {
+		wait := acmeCheckInterval
+		if m.needsRenewal() {
+			if err := m.obtain(ctx); err != nil {
+				logger.Log("ERROR", "ACME certificate request failed", []logger.LogDetail{
+					{Key: "domains", Value: strings.Join(m.domains, ",")},
+					{Key: "Error", Value: err.Error()},
+				})
+				wait = acmeRetryInterval
+			}
+		}
+
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// obtain runs a full ACME order and swaps in the new certificate.
+func (m *certManager) obtain(ctx context.Context) error {
+	m.obtainMu.Lock()
+	defer m.obtainMu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, acmeOrderTimeout)
+	defer cancel()
+
+	account := &acme.Account{}
+	if m.settings.Email != "" {
+		account.Contact = []string{"mailto:" + m.settings.Email}
+	}
+	if _, err := m.client.Register(ctx, account, acme.AcceptTOS); err != nil && !errors.Is(err, acme.ErrAccountAlreadyExists) {
+		return fmt.Errorf("account registration failed: %w", err)
+	}
+
+	order, err := m.client.AuthorizeOrder(ctx, acme.DomainIDs(m.domains...))
+	if err != nil {
+		return fmt.Errorf("order failed: %w", err)
+	}
+	orderURL := order.URI
+	for _, authzURL := range order.AuthzURLs {
+		if err := m.authorize(ctx, authzURL); err != nil {
+			return err
+		}
+	}
+	if order, err = m.client.WaitOrder(ctx, orderURL); err != nil {
+		return fmt.Errorf("order was not ready: %w", err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: strings.TrimPrefix(m.domains[0], "*.")},
+		DNSNames: m.domains,
+	}, key)
+	if err != nil {
+		return err
+	}
+	chain, _, err := m.client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		// alguns servidores (ex: Pebble) não devolvem Location no finalize
+		if chain, err = m.fetchOrderCert(ctx, orderURL, err); err != nil {
+			return fmt.Errorf("finalize failed: %w", err)
+		}
+	}
+
+	cert, err := m.store(chain, key)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	m.cert = cert
+	m.mu.Unlock()
+
+	logger.Log("INFO", "ACME certificate issued", []logger.LogDetail{
+		{Key: "domains", Value: strings.Join(m.domains, ",")},
+		{Key: "expires", Value: cert.Leaf.NotAfter.Format(time.RFC3339)},
+	})
+	return nil
+}
+
+// fetchOrderCert polls the order by its own URL after a failed finalize and
+// downloads the certificate once issued, otherwise it returns cause.
+func (m *certManager) fetchOrderCert(ctx context.Context, orderURL string, cause error) ([][]byte, error) {
+	order, err := m.client.WaitOrder(ctx, orderURL)
+	if err != nil || order.Status != acme.StatusValid {
+		return nil, cause
+	}
+	return m.client.FetchCert(ctx, order.CertURL, true)
+}
+
+func (m *certManager) authorize(ctx context.Context, authzURL string) error {
+	authz, err := m.client.GetAuthorization(ctx, authzURL)
+	if err != nil {
+		return err
+	}
+	if authz.Status == acme.StatusValid {
+		return nil
+	}
+
+	domain := authz.Identifier.Value
+	want := "http-01"
+	if authz.Wildcard || m.settings.DNSHook != "" && !m.servesHTTP(domain) {
+		want = "dns-01"
+	}
+
+	var challenge *acme.Challenge
+	for _, c := range authz.Challenges {
+		if c.Type == want {
+			challenge = c
+		}
+	}
+	if challenge == nil {
+		return fmt.Errorf("%s challenge not offered for %s", want, domain)
+	}
+
+	switch want {
+	case "http-01":
+		keyAuth, err := m.client.HTTP01ChallengeResponse(challenge.Token)
+		if err != nil {
+			return err
+		}
+		m.mu.Lock()
+		m.tokens[challenge.Token] = keyAuth
+		m.mu.Unlock()
+		defer func() {
+			m.mu.Lock()
+			delete(m.tokens, challenge.Token)
+			m.mu.Unlock()
+		}()
+
+	case "dns-01":
+		value, err := m.client.DNS01ChallengeRecord(challenge.Token)
+		if err != nil {
+			return err
+		}
+		fqdn := "_acme-challenge." + domain + "."
+		if err := m.dnsHook(ctx, "present", domain, fqdn, value); err != nil {
+			return err
+		}
+		defer func() {
+			if err := m.dnsHook(context.Background(), "cleanup", domain, fqdn, value); err != nil {
+				logger.Log("WARN", "ACME dns cleanup failed", []logger.LogDetail{
+					{Key: "domain", Value: domain},
+					{Key: "Error", Value: err.Error()},
+				})
+			}
+		}()
+	}
+
+	if _, err := m.client.Accept(ctx, challenge); err != nil {
+		return fmt.Errorf("%s challenge for %s was not accepted: %w", want, domain, err)
+	}
+	if _, err := m.client.WaitAuthorization(ctx, authz.URI); err != nil {
+		return fmt.Errorf("%s challenge for %s failed: %w", want, domain, err)
+	}
+
+	logger.Log("DEBUG", "ACME authorization valid", []logger.LogDetail{
+		{Key: "domain", Value: domain},
+		{Key: "challenge", Value: want},
+	})
+	return nil
+}
+
+// servesHTTP tells whether domain reaches this server on :80, which is true
+// for every name routed in [domains].
+func (m *certManager) servesHTTP(domain string) bool {
+	return current.Load().routes.lookup(domain) != nil
+}
+
+// dnsHook runs: <dns_hook> present|cleanup <domain> <fqdn> <value>. The hook
+// must only return once the record is visible to the ACME server.
+func (m *certManager) dnsHook(ctx context.Context, action, domain, fqdn, value string) error {
+	cmd := exec.CommandContext(ctx, m.settings.DNSHook, action, domain, fqdn, value)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("dns hook %s failed: %w: %s", action, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// store writes the certificate and its key to the cache.
+func (m *certManager) store(chain [][]byte, key *ecdsa.PrivateKey) (*tls.Certificate, error) {
+	var certPEM []byte
+	for _, der := range chain {
+		certPEM = append(certPEM, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	// Certificado por último: um par que não casa falha no load e é reemitido
+	if err := writeFileAtomic(m.keyPath(), keyPEM, 0o600); err != nil {
+		return nil, err
+	}
+	if err := writeFileAtomic(m.certPath(), certPEM, 0o644); err != nil {
+		return nil, err
+	}
+	return &cert, nil
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames
+// it into place, so a crash never leaves a truncated file behind.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func loadOrCreateKey(path string) (crypto.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("invalid key file %s", path)
+		}
+		return x509.ParseECPrivateKey(block.Bytes)
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
@@ -0,0 +1,290 @@
+package expose
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testCertificate returns a self-signed certificate for names that expires
+// at notAfter, with Leaf filled in like tls.LoadX509KeyPair does.
+func testCertificate(t *testing.T, notAfter time.Time, names ...string) *tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: names[0]},
+		DNSNames:     names,
+		NotBefore:    notAfter.Add(-365 * 24 * time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func TestNeedsRenewal(t *testing.T) {
+	const day = 24 * time.Hour
+	now := time.Now()
+
+	tests := []struct {
+		name        string
+		cert        *tls.Certificate
+		domains     []string
+		renewBefore time.Duration
+		want        bool
+	}{
+		{
+			name:        "no certificate",
+			domains:     []string{"tunnerse.com"},
+			renewBefore: 30 * day,
+			want:        true,
+		},
+		{
+			name:        "certificate without leaf",
+			cert:        &tls.Certificate{},
+			domains:     []string{"tunnerse.com"},
+			renewBefore: 30 * day,
+			want:        true,
+		},
+		{
+			name:        "outside the renewal window",
+			cert:        testCertificate(t, now.Add(60*day), "tunnerse.com"),
+			domains:     []string{"tunnerse.com"},
+			renewBefore: 30 * day,
+			want:        false,
+		},
+		{
+			name:        "inside the renewal window",
+			cert:        testCertificate(t, now.Add(10*day), "tunnerse.com"),
+			domains:     []string{"tunnerse.com"},
+			renewBefore: 30 * day,
+			want:        true,
+		},
+		{
+			name:        "just before the window opens",
+			cert:        testCertificate(t, now.Add(30*day+time.Hour), "tunnerse.com"),
+			domains:     []string{"tunnerse.com"},
+			renewBefore: 30 * day,
+			want:        false,
+		},
+		{
+			name:        "expired",
+			cert:        testCertificate(t, now.Add(-time.Hour), "tunnerse.com"),
+			domains:     []string{"tunnerse.com"},
+			renewBefore: 30 * day,
+			want:        true,
+		},
+		{
+			name:        "zero renew_before waits for expiry",
+			cert:        testCertificate(t, now.Add(time.Hour), "tunnerse.com"),
+			domains:     []string{"tunnerse.com"},
+			renewBefore: 0,
+			want:        false,
+		},
+		{
+			name:        "domain added on reload",
+			cert:        testCertificate(t, now.Add(60*day), "tunnerse.com"),
+			domains:     []string{"tunnerse.com", "api.tunnerse.com"},
+			renewBefore: 30 * day,
+			want:        true,
+		},
+		{
+			name:        "wildcard covered",
+			cert:        testCertificate(t, now.Add(60*day), "tunnerse.com", "*.tunnerse.com"),
+			domains:     []string{"tunnerse.com", "*.tunnerse.com"},
+			renewBefore: 30 * day,
+			want:        false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &certManager{
+				settings: acmeConfig{RenewBefore: tt.renewBefore},
+				domains:  tt.domains,
+				cert:     tt.cert,
+			}
+			if got := m.needsRenewal(); got != tt.want {
+				t.Errorf("needsRenewal() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStoreReplacesCachedPair(t *testing.T) {
+	cache := t.TempDir()
+	m := &certManager{settings: acmeConfig{Cache: cache}, domains: []string{"*.tunnerse.com"}}
+
+	// Um par antigo já está no cache
+	for _, path := range []string{m.keyPath(), m.certPath()} {
+		if err := os.WriteFile(path, []byte("old"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	issued := testCertificate(t, time.Now().Add(time.Hour), "*.tunnerse.com")
+	cert, err := m.store(issued.Certificate, issued.PrivateKey.(*ecdsa.PrivateKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := tls.LoadX509KeyPair(m.certPath(), m.keyPath())
+	if err != nil {
+		t.Fatalf("cached pair does not load: %v", err)
+	}
+	if !slices.Equal(loaded.Certificate[0], cert.Certificate[0]) {
+		t.Error("cached certificate differs from the stored one")
+	}
+	info, err := os.Stat(m.keyPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("key file mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	// Nenhum arquivo temporário sobra no cache
+	entries, err := os.ReadDir(cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		names := make([]string, 0, len(entries))
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		t.Errorf("cache holds %v, want only the key and the certificate", names)
+	}
+}
+
+// TestCertManagerObtainPebble runs a full order against a Pebble server. It
+// only runs when TUNNERSE_ACME_TEST_DIRECTORY is set, e.g.:
+//
+//	pebble -config test/config/pebble-config.json -dnsserver 127.0.0.1:8053
+//	pebble-challtestsrv -http01 "" -https01 "" -tlsalpn01 "" -doh ""
+//
+//	TUNNERSE_ACME_TEST_DIRECTORY=https://127.0.0.1:14000/dir \
+//	TUNNERSE_ACME_TEST_CA=test/certs/pebble.minica.pem \
+//	go test ./internal/api/expose -run Pebble
+//
+// The HTTP-01 challenge is answered on TUNNERSE_ACME_TEST_HTTP (":5002" by
+// default, the httpPort of the sample Pebble config). With
+// TUNNERSE_ACME_TEST_DNS_HOOK set the certificate also gets a wildcard
+// validated through DNS-01.
+func TestCertManagerObtainPebble(t *testing.T) {
+	directory := os.Getenv("TUNNERSE_ACME_TEST_DIRECTORY")
+	if directory == "" {
+		t.Skip("TUNNERSE_ACME_TEST_DIRECTORY not set")
+	}
+	addr := os.Getenv("TUNNERSE_ACME_TEST_HTTP")
+	if addr == "" {
+		addr = ":5002"
+	}
+
+	settings := *defaultACMEConfig()
+	settings.Directory = directory
+	settings.DirectoryCA = os.Getenv("TUNNERSE_ACME_TEST_CA")
+	settings.Cache = t.TempDir()
+	settings.DNSHook = os.Getenv("TUNNERSE_ACME_TEST_DNS_HOOK")
+	// O Pebble pode emitir pelo perfil curto, de seis dias
+	settings.RenewBefore = 24 * time.Hour
+
+	domains := []string{"acme.tunnerse.test"}
+	if settings.DNSHook != "" {
+		domains = append(domains, "*.acme.tunnerse.test")
+
+		// Com hook o manager consulta as rotas para decidir entre HTTP-01 e DNS-01
+		routes, err := compileRoutes(map[string]string{"acme.tunnerse.test": "8080"}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		saved := current.Load()
+		current.Store(&exposeState{routes: routes})
+		t.Cleanup(func() { current.Store(saved) })
+	}
+
+	m, err := newCertManager(settings, domains)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.needsRenewal() {
+		t.Fatal("new manager without a cached certificate does not need renewal")
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatalf("failed to listen for HTTP-01 on %s: %v", addr, err)
+	}
+	var active atomic.Pointer[certManager]
+	active.Store(m)
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		active.Load().HTTPHandler(http.NotFoundHandler()).ServeHTTP(w, r)
+	})}
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	if err := m.obtain(ctx); err != nil {
+		t.Fatalf("obtain() failed: %v", err)
+	}
+
+	cert, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: domains[0]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := slices.Sorted(slices.Values(cert.Leaf.DNSNames)); !slices.Equal(names, slices.Sorted(slices.Values(domains))) {
+		t.Errorf("certificate names = %v, want %v", cert.Leaf.DNSNames, domains)
+	}
+	if m.needsRenewal() {
+		t.Error("fresh certificate still needs renewal")
+	}
+	if len(m.tokens) != 0 {
+		t.Errorf("%d HTTP-01 tokens left after the order", len(m.tokens))
+	}
+
+	// Um novo processo lê a conta e o certificado do cache sem pedir outro
+	reloaded, err := newCertManager(settings, domains)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reloaded.needsRenewal() {
+		t.Error("certificate loaded from the cache needs renewal")
+	}
+	active.Store(reloaded)
+
+	// Dentro da janela de renovação a conta em cache faz um novo pedido
+	reloaded.settings.RenewBefore = 365 * 24 * time.Hour
+	if !reloaded.needsRenewal() {
+		t.Fatal("certificate inside the renewal window does not need renewal")
+	}
+	if err := reloaded.obtain(ctx); err != nil {
+		t.Fatalf("renewal failed: %v", err)
+	}
+	renewed, _ := reloaded.GetCertificate(&tls.ClientHelloInfo{})
+	if renewed.Leaf.SerialNumber.Cmp(cert.Leaf.SerialNumber) == 0 {
+		t.Error("renewal kept the old certificate")
+	}
+}
@@ -0,0 +1,133 @@
+package expose
+
+import (
+	"crypto/tls"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/logger"
+)
+
+// Par legado usado como padrão quando [certificates] não define "default".
+var (
+	defaultCertFile = filepath.Join("certs", "certificates", "tunnerse.com.crt")
+	defaultKeyFile  = filepath.Join("certs", "certificates", "tunnerse.com.key")
+)
+
+// certEntry is one line of the [certificates] section:
+// domain = cert_file, key_file
+type certEntry struct {
+	Domain   string
+	CertFile string
+	KeyFile  string
+}
+
+func parseCertEntry(line string) (certEntry, error) {
+	domain, files, ok := strings.Cut(line, "=")
+	if !ok {
+		return certEntry{}, fmt.Errorf("invalid line on config: %s", line)
+	}
+	certFile, keyFile, ok := strings.Cut(files, ",")
+	if !ok {
+		return certEntry{}, fmt.Errorf("certificate must be \"domain = cert_file, key_file\": %s", line)
+	}
+
+	entry := certEntry{
+		Domain:   strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), "."),
+		CertFile: strings.TrimSpace(certFile),
+		KeyFile:  strings.TrimSpace(keyFile),
+	}
+	if entry.Domain == "" {
+		return certEntry{}, fmt.Errorf("invalid or null certificate domain")
+	}
+	if entry.CertFile == "" || entry.KeyFile == "" {
+		return certEntry{}, fmt.Errorf("invalid or null certificate files for %s", entry.Domain)
+	}
+	return entry, nil
+}
+
+// certStore picks the certificate for each handshake from the SNI name:
+// exact entries first, then the wildcard one label up, then ACME, then the
+// default certificate.
+type certStore struct {
+	exact    map[string]*tls.Certificate
+	wildcard map[string]*tls.Certificate // "*.tunnerse.com" indexado por "tunnerse.com"
+	fallback *tls.Certificate
+	acme     *certManager
+}
+
+// newCertStore loads every entry from disk. The "default" entry answers
+// unknown names; without it the legacy certs/certificates/tunnerse.com pair
+// is used when present.
+func newCertStore(entries []certEntry, acme *certManager) (*certStore, error) {
+	store := &certStore{
+		exact:    make(map[string]*tls.Certificate),
+		wildcard: make(map[string]*tls.Certificate),
+		acme:     acme,
+	}
+
+	for _, entry := range entries {
+		cert, err := tls.LoadX509KeyPair(entry.CertFile, entry.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load certificate for %s: %w", entry.Domain, err)
+		}
+
+		switch {
+		case entry.Domain == "default":
+			store.fallback = &cert
+		case strings.HasPrefix(entry.Domain, "*."):
+			store.wildcard[entry.Domain[2:]] = &cert
+		default:
+			store.exact[entry.Domain] = &cert
+		}
+
+		if entry.Domain != "default" && cert.Leaf.VerifyHostname(strings.Replace(entry.Domain, "*", "wildcard", 1)) != nil {
+			logger.Log("WARN", "Certificate does not cover its domain", []logger.LogDetail{
+				{Key: "domain", Value: entry.Domain},
+				{Key: "certFile", Value: entry.CertFile},
+				{Key: "names", Value: strings.Join(cert.Leaf.DNSNames, ",")},
+			})
+		}
+	}
+
+	if store.fallback == nil {
+		if cert, err := tls.LoadX509KeyPair(defaultCertFile, defaultKeyFile); err == nil {
+			store.fallback = &cert
+		} else if len(entries) == 0 && acme == nil {
+			return nil, fmt.Errorf("failed to load certificate: %w", err)
+		}
+	}
+
+	return store, nil
+}
+
+// GetCertificate implements tls.Config.GetCertificate.
+func (s *certStore) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	name := strings.TrimSuffix(strings.ToLower(hello.ServerName), ".")
+
+	if name != "" {
+		if cert, ok := s.exact[name]; ok {
+			return cert, nil
+		}
+		// o curinga só cobre um nível: *.tunnerse.com serve a.tunnerse.com
+		if _, parent, ok := strings.Cut(name, "."); ok {
+			if cert, ok := s.wildcard[parent]; ok {
+				return cert, nil
+			}
+		}
+		if s.acme != nil && s.acme.covers(name) {
+			if cert, err := s.acme.GetCertificate(hello); err == nil {
+				return cert, nil
+			}
+		}
+	}
+
+	if s.fallback != nil {
+		return s.fallback, nil
+	}
+	if s.acme != nil {
+		return s.acme.GetCertificate(hello)
+	}
+	return nil, fmt.Errorf("no certificate for %q", name)
+}
@@ -0,0 +1,121 @@
+package expose
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeCertificate saves cert as a PEM pair in dir, named after its first
+// name.
+func writeCertificate(t *testing.T, dir string, cert *tls.Certificate) (certFile, keyFile string) {
+	t.Helper()
+	keyDER, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := cacheName(cert.Leaf.Subject.CommonName)
+	certFile = filepath.Join(dir, name+".crt")
+	keyFile = filepath.Join(dir, name+".key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestCertStoreGetCertificate(t *testing.T) {
+	dir := t.TempDir()
+	expires := time.Now().Add(24 * time.Hour)
+
+	// Sem o par legado no disco o padrão vem só de [certificates]
+	legacyCert, legacyKey := defaultCertFile, defaultKeyFile
+	t.Cleanup(func() { defaultCertFile, defaultKeyFile = legacyCert, legacyKey })
+	defaultCertFile, defaultKeyFile = filepath.Join(dir, "missing.crt"), filepath.Join(dir, "missing.key")
+
+	var entries []certEntry
+	for domain, names := range map[string][]string{
+		"api.tunnerse.com": {"api.tunnerse.com"},
+		"*.tunnerse.com":   {"*.tunnerse.com"},
+		"default":          {"default.invalid"},
+	} {
+		certFile, keyFile := writeCertificate(t, dir, testCertificate(t, expires, names...))
+		entries = append(entries, certEntry{Domain: domain, CertFile: certFile, KeyFile: keyFile})
+	}
+
+	acmeDomains := []string{"tunnerse.com", "*.tunnerse.com", "*.apps.tunnerse.com"}
+	issued := &certManager{domains: acmeDomains, cert: testCertificate(t, expires, acmeDomains...)}
+	pending := &certManager{domains: acmeDomains}
+
+	stores := map[string]*certStore{}
+	for name, setup := range map[string]struct {
+		entries []certEntry
+		acme    *certManager
+	}{
+		"full":         {entries, issued},
+		"acme pending": {entries, pending},
+		"acme only":    {nil, issued},
+		"pending only": {nil, pending},
+	} {
+		store, err := newCertStore(setup.entries, setup.acme)
+		if err != nil {
+			t.Fatalf("newCertStore(%s): %v", name, err)
+		}
+		stores[name] = store
+	}
+	if _, err := newCertStore(nil, nil); err == nil {
+		t.Error("newCertStore() without certificates nor acme succeeded")
+	}
+
+	// O par legado vira o padrão quando não há entrada "default"
+	defaultCertFile, defaultKeyFile = writeCertificate(t, dir, testCertificate(t, expires, "legacy.invalid"))
+	legacy, err := newCertStore(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stores["legacy"] = legacy
+
+	tests := []struct {
+		name       string
+		store      string
+		serverName string
+		want       string // CommonName do certificado servido, vazio para erro
+	}{
+		{name: "exact beats wildcard and acme", store: "full", serverName: "api.tunnerse.com", want: "api.tunnerse.com"},
+		{name: "name is normalized", store: "full", serverName: "API.Tunnerse.com.", want: "api.tunnerse.com"},
+		{name: "wildcard beats acme", store: "full", serverName: "www.tunnerse.com", want: "*.tunnerse.com"},
+		{name: "wildcard does not cover the apex", store: "full", serverName: "tunnerse.com", want: "tunnerse.com"},
+		{name: "acme wildcard", store: "full", serverName: "x.apps.tunnerse.com", want: "tunnerse.com"},
+		{name: "wildcard covers one label", store: "full", serverName: "a.b.tunnerse.com", want: "default.invalid"},
+		{name: "unknown name", store: "full", serverName: "example.com", want: "default.invalid"},
+		{name: "no sni", store: "full", serverName: "", want: "default.invalid"},
+		{name: "acme not issued yet", store: "acme pending", serverName: "tunnerse.com", want: "default.invalid"},
+		{name: "acme answers without default", store: "acme only", serverName: "example.com", want: "tunnerse.com"},
+		{name: "nothing to serve", store: "pending only", serverName: "tunnerse.com"},
+		{name: "legacy pair as default", store: "legacy", serverName: "example.com", want: "legacy.invalid"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cert, err := stores[tt.store].GetCertificate(&tls.ClientHelloInfo{ServerName: tt.serverName})
+			if tt.want == "" {
+				if err == nil {
+					t.Errorf("GetCertificate() = %v, want an error", cert.Leaf.Subject.CommonName)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetCertificate() error = %v", err)
+			}
+			if got := cert.Leaf.Subject.CommonName; got != tt.want {
+				t.Errorf("GetCertificate() served %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,29 +2,40 @@ package expose
 
 import (
 	"bufio"
+	"crypto/tls"
 	"fmt"
 	"net/http"
-	"net/http/httputil"
-	"net/url"
 	"os"
-	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/pedroborgesdev/tunnerse-api/internal/api/logger"
 )
 
-var (
-	routes       = make(map[string]string)
-	redirectList = make([]string, 0)
-)
+const configPath = "tunnerse.config"
+
+// exposeConfig is one parsed tunnerse.config. It is never mutated after
+// loadConfig returns, so a reload only has to swap the pointer.
+type exposeConfig struct {
+	routes       map[string]string
+	redirects    []redirectRule
+	certEntries  []certEntry
+	acmeSettings *acmeConfig // nil mantém os certificados estáticos
+}
 
-func loadConfig(path string) error {
+func loadConfig(path string) (*exposeConfig, error) {
 	file, err := os.Open(path)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer file.Close()
 
+	cfg := &exposeConfig{
+		routes:      make(map[string]string),
+		redirects:   make([]redirectRule, 0),
+		certEntries: make([]certEntry, 0),
+	}
+
 	scanner := bufio.NewScanner(file)
 	var section string
 	domainsFound := false
@@ -49,103 +60,148 @@ func loadConfig(path string) error {
 		case "domains":
 			parts := strings.Split(line, "=")
 			if len(parts) != 2 {
-				return fmt.Errorf("invalid line on config: %s", line)
+				return nil, fmt.Errorf("invalid line on config: %s", line)
 			}
 			domain := strings.TrimSpace(parts[0])
 			port := strings.TrimSpace(parts[1])
 
 			if domain == "" {
-				return fmt.Errorf("invalid or null domain")
+				return nil, fmt.Errorf("invalid or null domain")
 			}
 			if port == "" {
-				return fmt.Errorf("invalid or null port")
+				return nil, fmt.Errorf("invalid or null port")
 			}
 
-			routes[domain] = port
+			cfg.routes[domain] = port
 			domainsCount++
 
 		case "redirects":
-			redirectList = append(redirectList, strings.ToLower(line))
+			rule, err := parseRedirect(line)
+			if err != nil {
+				return nil, err
+			}
+			cfg.redirects = append(cfg.redirects, rule)
 			redirectsCount++
+
+		case "certificates":
+			entry, err := parseCertEntry(line)
+			if err != nil {
+				return nil, err
+			}
+			cfg.certEntries = append(cfg.certEntries, entry)
+
+		case "acme":
+			if cfg.acmeSettings == nil {
+				cfg.acmeSettings = defaultACMEConfig()
+			}
+			if err := cfg.acmeSettings.set(line); err != nil {
+				return nil, err
+			}
 		}
 	}
 
 	if err := scanner.Err(); err != nil {
-		return err
+		return nil, err
 	}
 
 	if !domainsFound {
-		return fmt.Errorf("config file must contain [domains] section")
+		return nil, fmt.Errorf("config file must contain [domains] section")
 	}
 	if domainsCount == 0 {
-		return fmt.Errorf("[domains] section is empty, configure at least one domain")
+		return nil, fmt.Errorf("[domains] section is empty, configure at least one domain")
+	}
+
+	if cfg.acmeSettings != nil {
+		if err := cfg.acmeSettings.validate(); err != nil {
+			return nil, err
+		}
 	}
 
-	return nil
+	return cfg, nil
 }
 
-func newReverseProxy(target string) *httputil.ReverseProxy {
-	u, _ := url.Parse(target)
-	return httputil.NewSingleHostReverseProxy(u)
+// acmeDomains lists the names of the ACME certificate: the [acme] domains
+// option, or every route in [domains].
+func (c *exposeConfig) acmeDomains() []string {
+	if len(c.acmeSettings.Domains) > 0 {
+		return c.acmeSettings.Domains
+	}
+	domains := make([]string, 0, len(c.routes))
+	for domain := range c.routes {
+		domains = append(domains, strings.ToLower(domain))
+	}
+	sort.Strings(domains)
+	return domains
 }
 
 func handler(w http.ResponseWriter, r *http.Request) {
 	host := strings.ToLower(strings.Split(r.Host, ":")[0])
+	state := current.Load()
 
-	for domain, port := range routes {
-		domain = strings.ToLower(domain)
+	if applyRedirects(state.config.redirects, host, w, r) {
+		return
+	}
 
-		if strings.HasPrefix(domain, "*.") {
-			base := strings.TrimPrefix(domain, "*.")
-			if strings.HasSuffix(host, "."+base) || host == base {
-				target := fmt.Sprintf("http://localhost:%s", port)
-				newReverseProxy(target).ServeHTTP(w, r)
-				return
-			}
-		} else if host == domain {
-			target := fmt.Sprintf("http://localhost:%s", port)
-			newReverseProxy(target).ServeHTTP(w, r)
-			return
-		}
+	if proxy := state.routes.lookup(host); proxy != nil {
+		proxy.ServeHTTP(w, r)
+		return
 	}
 
 	http.Error(w, "domain not configured", http.StatusNotFound)
 }
 
 func StartExpose() (<-chan error, error) {
-	if err := loadConfig("tunnerse.config"); err != nil {
+	cfg, err := loadConfig(configPath)
+	if err != nil {
 		return nil, fmt.Errorf("error to load config: %v", err)
 	}
 
-	wd, err := os.Getwd()
+	state, err := newExposeState(cfg, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get working directory: %w", err)
+		return nil, err
 	}
-
-	certFile := filepath.Join(wd, "certs", "certificates", "tunnerse.com.crt")
-	keyFile := filepath.Join(wd, "certs", "certificates", "tunnerse.com.key")
+	current.Store(state)
 
 	errCh := make(chan error, 2)
 
+	redirect := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		url := "https://" + r.Host + r.URL.String()
+		http.Redirect(w, r, url, http.StatusMovedPermanently)
+	})
+
 	redirectSrv := &http.Server{
 		Addr: ":80",
 		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			url := "https://" + r.Host + r.URL.String()
-			http.Redirect(w, r, url, http.StatusMovedPermanently)
+			if manager := current.Load().acme; manager != nil {
+				manager.HTTPHandler(redirect).ServeHTTP(w, r)
+				return
+			}
+			redirect(w, r)
 		}),
 	}
 
 	httpsSrv := &http.Server{
 		Addr:    ":443",
 		Handler: http.HandlerFunc(handler),
+		TLSConfig: &tls.Config{
+			GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+				return current.Load().certs.GetCertificate(hello)
+			},
+		},
 	}
 
-	logger.Log("INFO", "Expose iniciado", []logger.LogDetail{
+	details := []logger.LogDetail{
 		{Key: "redirect", Value: ":80"},
 		{Key: "https", Value: ":443"},
-		{Key: "certFile", Value: certFile},
-		{Key: "keyFile", Value: keyFile},
-	})
+		{Key: "certificates", Value: fmt.Sprint(len(cfg.certEntries))},
+	}
+	if state.acme != nil {
+		details = append(details,
+			logger.LogDetail{Key: "acme", Value: cfg.acmeSettings.Directory},
+			logger.LogDetail{Key: "domains", Value: strings.Join(state.acme.domains, ",")},
+		)
+	}
+	logger.Log("INFO", "Expose iniciado", details)
 
 	go func() {
 		if err := redirectSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
@@ -154,11 +210,15 @@ func StartExpose() (<-chan error, error) {
 	}()
 
 	go func() {
-		if err := httpsSrv.ListenAndServeTLS(certFile, keyFile); err != nil && err != http.ErrServerClosed {
+		if err := httpsSrv.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
 			errCh <- fmt.Errorf("https server error: %w", err)
 		}
 	}()
 
+	// o desafio HTTP-01 precisa do :80 já escutando
+	state.startACME(nil)
+	go watchConfig()
+
 	return errCh, nil
 }
 
@@ -0,0 +1,144 @@
+package expose
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// redirectRule is one line of the [redirects] section:
+//
+//	from -> to [code]
+//
+// from is "host/path", "host" (every path) or "/path" (every host); each *
+// is captured and can be used in to as $1..$9, numbered from left to right.
+// to is an absolute URL or a path on the same host. The query string of the
+// request is kept, merged after the one in to. code defaults to 301.
+type redirectRule struct {
+	raw     string
+	host    *regexp.Regexp // nil casa qualquer host
+	path    *regexp.Regexp // nil casa qualquer caminho
+	target  string
+	keep    bool // Destino só com origem: mantém o caminho da requisição
+	code    int
+	capture int
+}
+
+var redirectCapture = regexp.MustCompile(`\$([0-9])`)
+
+func parseRedirect(line string) (redirectRule, error) {
+	from, rest, ok := strings.Cut(line, "->")
+	if !ok {
+		return redirectRule{}, fmt.Errorf("redirect must be \"from -> to [code]\": %s", line)
+	}
+	from = strings.TrimSpace(from)
+	fields := strings.Fields(rest)
+	if from == "" || len(fields) == 0 || len(fields) > 2 {
+		return redirectRule{}, fmt.Errorf("redirect must be \"from -> to [code]\": %s", line)
+	}
+
+	rule := redirectRule{raw: line, target: fields[0], code: http.StatusMovedPermanently}
+	if len(fields) == 2 {
+		code, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return redirectRule{}, fmt.Errorf("invalid redirect code: %s", fields[1])
+		}
+		switch code {
+		case http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+			rule.code = code
+		default:
+			return redirectRule{}, fmt.Errorf("redirect code must be 301, 302, 307 or 308: %d", code)
+		}
+	}
+
+	host, path := from, ""
+	if i := strings.Index(from, "/"); i >= 0 {
+		host, path = from[:i], from[i:]
+	}
+	if host != "" {
+		rule.host = compileWildcard(strings.ToLower(host), "(.+)")
+		rule.capture += strings.Count(host, "*")
+	}
+	if path != "" {
+		rule.path = compileWildcard(path, "(.*)")
+		rule.capture += strings.Count(path, "*")
+	}
+
+	target := rule.target
+	switch {
+	case strings.HasPrefix(target, "http://"), strings.HasPrefix(target, "https://"):
+		origin := target[strings.Index(target, "//")+2:]
+		rule.keep = !strings.ContainsAny(origin, "/?")
+	case strings.HasPrefix(target, "/"):
+	default:
+		return redirectRule{}, fmt.Errorf("redirect target must be an http(s) url or a path: %s", target)
+	}
+
+	for _, match := range redirectCapture.FindAllStringSubmatch(target, -1) {
+		if n, _ := strconv.Atoi(match[1]); n == 0 || n > rule.capture {
+			return redirectRule{}, fmt.Errorf("redirect target uses %s but from has %d wildcards: %s", match[0], rule.capture, line)
+		}
+	}
+
+	return rule, nil
+}
+
+// compileWildcard quotes pattern and turns each * into group.
+func compileWildcard(pattern, group string) *regexp.Regexp {
+	parts := strings.Split(pattern, "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	return regexp.MustCompile("^" + strings.Join(parts, group) + "$")
+}
+
+// match returns the redirect location for r, or false.
+func (rule *redirectRule) match(host string, r *http.Request) (string, bool) {
+	captures := make([]string, 0, rule.capture)
+	if rule.host != nil {
+		groups := rule.host.FindStringSubmatch(host)
+		if groups == nil {
+			return "", false
+		}
+		captures = append(captures, groups[1:]...)
+	}
+	path := r.URL.EscapedPath()
+	if rule.path != nil {
+		groups := rule.path.FindStringSubmatch(path)
+		if groups == nil {
+			return "", false
+		}
+		captures = append(captures, groups[1:]...)
+	}
+
+	location := redirectCapture.ReplaceAllStringFunc(rule.target, func(ref string) string {
+		n, _ := strconv.Atoi(ref[1:])
+		return captures[n-1]
+	})
+	if rule.keep {
+		location = strings.TrimSuffix(location, "/") + path
+	}
+
+	if r.URL.RawQuery != "" {
+		if strings.Contains(location, "?") {
+			location += "&" + r.URL.RawQuery
+		} else {
+			location += "?" + r.URL.RawQuery
+		}
+	}
+	return location, true
+}
+
+// applyRedirects answers r with the first matching rule and reports whether
+// it did.
+func applyRedirects(rules []redirectRule, host string, w http.ResponseWriter, r *http.Request) bool {
+	for i := range rules {
+		if location, ok := rules[i].match(host, r); ok {
+			http.Redirect(w, r, location, rules[i].code)
+			return true
+		}
+	}
+	return false
+}
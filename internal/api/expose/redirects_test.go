@@ -0,0 +1,247 @@
+package expose
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+)
+
+func mustRedirects(t *testing.T, lines ...string) []redirectRule {
+	t.Helper()
+	rules := make([]redirectRule, 0, len(lines))
+	for _, line := range lines {
+		rule, err := parseRedirect(line)
+		if err != nil {
+			t.Fatalf("parseRedirect(%q) failed: %v", line, err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+func TestParseRedirectInvalid(t *testing.T) {
+	tests := []string{
+		"old.com",
+		"old.com ->",
+		"-> https://new.com",
+		"old.com -> https://new.com 301 extra",
+		"old.com -> https://new.com abc",
+		"old.com -> https://new.com 303",
+		"old.com -> https://new.com 200",
+		"old.com -> new.com",
+		"old.com -> ftp://new.com",
+		"*.old.com -> https://$2.new.com",
+		"old.com -> https://new.com/$1",
+		"old.com/* -> /$0",
+	}
+
+	for _, line := range tests {
+		if _, err := parseRedirect(line); err == nil {
+			t.Errorf("parseRedirect(%q) succeeded, want an error", line)
+		}
+	}
+}
+
+func TestApplyRedirects(t *testing.T) {
+	tests := []struct {
+		name     string
+		rules    []string
+		url      string
+		code     int // 0 quando nenhuma regra casa
+		location string
+	}{
+		{
+			name:     "default code",
+			rules:    []string{"old.com -> https://new.com"},
+			url:      "http://old.com/",
+			code:     http.StatusMovedPermanently,
+			location: "https://new.com/",
+		},
+		{
+			name:     "found",
+			rules:    []string{"old.com -> https://new.com 302"},
+			url:      "http://old.com/",
+			code:     http.StatusFound,
+			location: "https://new.com/",
+		},
+		{
+			name:     "temporary",
+			rules:    []string{"old.com -> https://new.com 307"},
+			url:      "http://old.com/",
+			code:     http.StatusTemporaryRedirect,
+			location: "https://new.com/",
+		},
+		{
+			name:     "permanent",
+			rules:    []string{"old.com -> https://new.com 308"},
+			url:      "http://old.com/",
+			code:     http.StatusPermanentRedirect,
+			location: "https://new.com/",
+		},
+		{
+			name:     "origin target keeps the path",
+			rules:    []string{"old.com -> https://new.com"},
+			url:      "http://old.com/a/b",
+			code:     http.StatusMovedPermanently,
+			location: "https://new.com/a/b",
+		},
+		{
+			name:     "root target drops the path",
+			rules:    []string{"old.com -> https://new.com/"},
+			url:      "http://old.com/a/b",
+			code:     http.StatusMovedPermanently,
+			location: "https://new.com/",
+		},
+		{
+			name:     "target with path replaces it",
+			rules:    []string{"old.com -> https://new.com/home"},
+			url:      "http://old.com/a/b",
+			code:     http.StatusMovedPermanently,
+			location: "https://new.com/home",
+		},
+		{
+			name:     "host capture",
+			rules:    []string{"*.old.com -> https://$1.new.com"},
+			url:      "http://shop.old.com/cart",
+			code:     http.StatusMovedPermanently,
+			location: "https://shop.new.com/cart",
+		},
+		{
+			name:     "path capture",
+			rules:    []string{"/blog/* -> /posts/$1"},
+			url:      "http://any.com/blog/2024/hello",
+			code:     http.StatusMovedPermanently,
+			location: "/posts/2024/hello",
+		},
+		{
+			name:     "host and path captures numbered left to right",
+			rules:    []string{"*.old.com/*/docs/* -> https://docs.new.com/$1/$3?v=$2 308"},
+			url:      "http://api.old.com/v2/docs/auth",
+			code:     http.StatusPermanentRedirect,
+			location: "https://docs.new.com/api/auth?v=v2",
+		},
+		{
+			name:     "escaped path captured as is",
+			rules:    []string{"/files/* -> https://cdn.com/$1"},
+			url:      "http://old.com/files/a%20b.txt",
+			code:     http.StatusMovedPermanently,
+			location: "https://cdn.com/a%20b.txt",
+		},
+		{
+			name:     "query kept",
+			rules:    []string{"old.com -> https://new.com/home"},
+			url:      "http://old.com/?a=1&b=2",
+			code:     http.StatusMovedPermanently,
+			location: "https://new.com/home?a=1&b=2",
+		},
+		{
+			name:     "query merged after the target query",
+			rules:    []string{"old.com -> https://new.com/home?src=old"},
+			url:      "http://old.com/?a=1",
+			code:     http.StatusMovedPermanently,
+			location: "https://new.com/home?src=old&a=1",
+		},
+		{
+			name:     "query kept with the path",
+			rules:    []string{"old.com -> https://new.com"},
+			url:      "http://old.com/search?q=x",
+			code:     http.StatusMovedPermanently,
+			location: "https://new.com/search?q=x",
+		},
+		{
+			name:     "first matching rule wins",
+			rules:    []string{"/a/* -> /first/$1", "/a/b -> /second", "old.com -> https://third.com"},
+			url:      "http://old.com/a/b",
+			code:     http.StatusMovedPermanently,
+			location: "/first/b",
+		},
+		{
+			name:     "later rule when the first does not match",
+			rules:    []string{"/a/* -> /first/$1", "old.com -> https://third.com 302"},
+			url:      "http://old.com/b",
+			code:     http.StatusFound,
+			location: "https://third.com/b",
+		},
+		{
+			name:  "other host",
+			rules: []string{"old.com -> https://new.com"},
+			url:   "http://new.com/",
+		},
+		{
+			name:  "wildcard host needs a label",
+			rules: []string{"*.old.com -> https://$1.new.com"},
+			url:   "http://old.com/",
+		},
+		{
+			name:  "exact path only",
+			rules: []string{"old.com/a -> /b"},
+			url:   "http://old.com/a/c",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := mustRedirects(t, tt.rules...)
+			r := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			w := httptest.NewRecorder()
+
+			applied := applyRedirects(rules, r.URL.Hostname(), w, r)
+			if applied != (tt.code != 0) {
+				t.Fatalf("applyRedirects() = %v, want %v", applied, tt.code != 0)
+			}
+			if !applied {
+				return
+			}
+			if w.Code != tt.code {
+				t.Errorf("code = %d, want %d", w.Code, tt.code)
+			}
+			if got := w.Header().Get("Location"); got != tt.location {
+				t.Errorf("Location = %q, want %q", got, tt.location)
+			}
+		})
+	}
+}
+
+// useState stores state as the current one for the rest of the test.
+func useState(t testing.TB, state *exposeState) {
+	t.Helper()
+	saved := current.Load()
+	current.Store(state)
+	t.Cleanup(func() { current.Store(saved) })
+}
+
+func TestHandlerRedirectStopsProxying(t *testing.T) {
+	var hits atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	defer upstream.Close()
+	u, _ := url.Parse(upstream.URL)
+
+	routes, err := compileRoutes(map[string]string{"old.com": u.Port()}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	useState(t, &exposeState{
+		config: &exposeConfig{redirects: mustRedirects(t, "old.com/legacy/* -> https://new.com/$1")},
+		routes: routes,
+	})
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodPost, "http://old.com/legacy/x", nil))
+	if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "https://new.com/x" {
+		t.Errorf("redirected request = %d %q", w.Code, w.Header().Get("Location"))
+	}
+	if hits.Load() != 0 {
+		t.Fatal("redirected request reached the upstream")
+	}
+
+	w = httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, "http://old.com/current", nil))
+	if w.Code != http.StatusTeapot || hits.Load() != 1 {
+		t.Errorf("other request = %d with %d upstream hits, want it proxied", w.Code, hits.Load())
+	}
+}
@@ -0,0 +1,264 @@
+package expose
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/logger"
+)
+
+// reloadPollInterval is how often watchConfig compares the mtime and size of
+// the watched files. A change that keeps both, e.g. a rewrite of the same
+// size within the mtime granularity of the filesystem (1s on ext3, 2s on
+// FAT), is only picked up by SIGHUP.
+const reloadPollInterval = 5 * time.Second
+
+var (
+	current  atomic.Pointer[exposeState]
+	reloadMu sync.Mutex
+)
+
+// exposeState is everything the servers read per request. Handlers load it
+// once, so a reload never mixes routes of one config with certs of another.
+type exposeState struct {
+	config   *exposeConfig
+	routes   *routeTable
+	certs    *certStore
+	acme     *certManager
+	stopACME context.CancelFunc
+	stamps   map[string]string // Arquivo -> mtime/tamanho vistos no carregamento
+}
+
+// newExposeState loads the certificates of cfg. The ACME manager of prev is
+// kept when its settings and domains did not change, so a reload does not
+// trigger a new order.
+func newExposeState(cfg *exposeConfig, prev *exposeState) (*exposeState, error) {
+	var prevRoutes *routeTable
+	if prev != nil {
+		prevRoutes = prev.routes
+	}
+	routes, err := compileRoutes(cfg.routes, prevRoutes)
+	if err != nil {
+		return nil, err
+	}
+	state := &exposeState{config: cfg, routes: routes}
+
+	if cfg.acmeSettings != nil {
+		domains := cfg.acmeDomains()
+		if prev != nil && prev.acme != nil &&
+			reflect.DeepEqual(prev.acme.settings, *cfg.acmeSettings) && slices.Equal(prev.acme.domains, domains) {
+			state.acme = prev.acme
+			state.stopACME = prev.stopACME
+		} else {
+			manager, err := newCertManager(*cfg.acmeSettings, domains)
+			if err != nil {
+				return nil, fmt.Errorf("failed to start acme: %w", err)
+			}
+			state.acme = manager
+		}
+	}
+
+	state.certs, err = newCertStore(cfg.certEntries, state.acme)
+	if err != nil {
+		return nil, err
+	}
+	state.stamps = fileStamps(cfg.watchedFiles())
+
+	return state, nil
+}
+
+// startACME starts the renewal loop of a new manager and stops the one it
+// replaced. It must run after the state is stored, since HTTP-01 challenges
+// are answered from the current state.
+func (s *exposeState) startACME(prev *exposeState) {
+	if prev != nil && prev.acme != nil && prev.acme != s.acme {
+		prev.stopACME()
+	}
+	if s.acme != nil && (prev == nil || prev.acme != s.acme) {
+		ctx, cancel := context.WithCancel(context.Background())
+		s.stopACME = cancel
+		go s.acme.run(ctx)
+	}
+}
+
+// watchedFiles lists the config file and every certificate it loads.
+func (c *exposeConfig) watchedFiles() []string {
+	files := []string{configPath}
+	hasDefault := false
+	for _, entry := range c.certEntries {
+		files = append(files, entry.CertFile, entry.KeyFile)
+		hasDefault = hasDefault || entry.Domain == "default"
+	}
+	if !hasDefault {
+		files = append(files, defaultCertFile, defaultKeyFile)
+	}
+	return files
+}
+
+func fileStamps(files []string) map[string]string {
+	stamps := make(map[string]string, len(files))
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			stamps[file] = "missing"
+			continue
+		}
+		stamps[file] = fmt.Sprintf("%d/%d", info.ModTime().UnixNano(), info.Size())
+	}
+	return stamps
+}
+
+// watchConfig reloads on SIGHUP and whenever the config file or one of its
+// certificates changes on disk.
+func watchConfig() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	ticker := time.NewTicker(reloadPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-hup:
+			reload("signal")
+		case <-ticker.C:
+			state := current.Load()
+			if !reflect.DeepEqual(state.stamps, fileStamps(state.config.watchedFiles())) {
+				reload("file")
+			}
+		}
+	}
+}
+
+// reload validates the file and swaps the state; on any error the running
+// config stays in place.
+func reload(trigger string) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	prev := current.Load()
+
+	cfg, err := loadConfig(configPath)
+	if err == nil {
+		var state *exposeState
+		if state, err = newExposeState(cfg, prev); err == nil {
+			current.Store(state)
+			state.startACME(prev)
+			logReload(trigger, prev, state)
+			return
+		}
+	}
+
+	// guarda os stamps para não repetir o erro a cada ciclo até o arquivo mudar
+	failed := *prev
+	failed.stamps = fileStamps(prev.config.watchedFiles())
+	current.Store(&failed)
+
+	logger.Log("ERROR", "Expose config reload failed, keeping the previous config", []logger.LogDetail{
+		{Key: "trigger", Value: trigger},
+		{Key: "Error", Value: err.Error()},
+	})
+}
+
+func logReload(trigger string, prev, next *exposeState) {
+	details := []logger.LogDetail{{Key: "trigger", Value: trigger}}
+	add := func(key string, values []string) {
+		if len(values) > 0 {
+			details = append(details, logger.LogDetail{Key: key, Value: strings.Join(values, ", ")})
+		}
+	}
+
+	added, removed, changed := diffMaps(prev.config.routes, next.config.routes)
+	for i, domain := range added {
+		added[i] = domain + "=" + next.config.routes[domain]
+	}
+	for i, domain := range changed {
+		changed[i] = fmt.Sprintf("%s=%s->%s", domain, prev.config.routes[domain], next.config.routes[domain])
+	}
+	add("domains_added", added)
+	add("domains_removed", removed)
+	add("domains_changed", changed)
+
+	added, removed, _ = diffMaps(redirectSet(prev.config.redirects), redirectSet(next.config.redirects))
+	add("redirects_added", added)
+	add("redirects_removed", removed)
+
+	added, removed, changed = diffMaps(certSet(prev), certSet(next))
+	add("certificates_added", added)
+	add("certificates_removed", removed)
+	add("certificates_changed", changed)
+
+	if prev.acme != next.acme {
+		switch {
+		case next.acme == nil:
+			add("acme", []string{"disabled"})
+		case prev.acme == nil:
+			add("acme", []string{"enabled for " + strings.Join(next.acme.domains, ",")})
+		default:
+			add("acme", []string{"restarted for " + strings.Join(next.acme.domains, ",")})
+		}
+	}
+
+	if len(details) == 1 {
+		details = append(details, logger.LogDetail{Key: "changes", Value: "none"})
+	}
+	logger.Log("INFO", "Expose config reloaded", details)
+}
+
+// certSet maps each certificate domain to its files and their stamps, so a
+// certificate renewed in place shows up as changed.
+func certSet(state *exposeState) map[string]string {
+	set := make(map[string]string, len(state.config.certEntries))
+	for _, entry := range state.config.certEntries {
+		set[entry.Domain] = strings.Join([]string{
+			entry.CertFile, state.stamps[entry.CertFile],
+			entry.KeyFile, state.stamps[entry.KeyFile],
+		}, "|")
+	}
+	if _, ok := set["default"]; !ok {
+		if stamp := state.stamps[defaultCertFile]; stamp != "" && stamp != "missing" {
+			set[filepath.Base(defaultCertFile)] = stamp + "|" + state.stamps[defaultKeyFile]
+		}
+	}
+	return set
+}
+
+func redirectSet(rules []redirectRule) map[string]string {
+	set := make(map[string]string, len(rules))
+	for _, rule := range rules {
+		set[rule.raw] = ""
+	}
+	return set
+}
+
+func diffMaps(prev, next map[string]string) (added, removed, changed []string) {
+	for key, value := range next {
+		old, ok := prev[key]
+		switch {
+		case !ok:
+			added = append(added, key)
+		case old != value:
+			changed = append(changed, key)
+		}
+	}
+	for key := range prev {
+		if _, ok := next[key]; !ok {
+			removed = append(removed, key)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	sort.Strings(changed)
+	return added, removed, changed
+}
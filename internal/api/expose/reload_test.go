@@ -0,0 +1,251 @@
+package expose
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/logger"
+)
+
+// useConfigDir runs the test inside a temporary directory, where configPath
+// and the legacy certificate pair are looked up.
+func useConfigDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	return dir
+}
+
+// writeConfig replaces tunnerse.config and moves its mtime forward, so the
+// change is seen even where the filesystem keeps coarse timestamps.
+func writeConfig(t *testing.T, content string) {
+	t.Helper()
+	touch(t, configPath, content)
+}
+
+func touch(t *testing.T, path, content string) {
+	t.Helper()
+	var mtime time.Time
+	if info, err := os.Stat(path); err == nil {
+		mtime = info.ModTime().Add(time.Second)
+	} else {
+		mtime = time.Now()
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// captureLogs sends the logger to a JSON file and returns a reader of the
+// records written so far.
+func captureLogs(t *testing.T) func() []map[string]any {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "expose.log")
+	if err := logger.Setup(logger.Options{File: path, FileFormat: "json"}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { logger.Setup(logger.Options{}) })
+
+	return func() []map[string]any {
+		t.Helper()
+		file, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+
+		var records []map[string]any
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			record := map[string]any{}
+			if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+				t.Fatal(err)
+			}
+			records = append(records, record)
+		}
+		return records
+	}
+}
+
+// loadState parses content as tunnerse.config and builds its state.
+func loadState(t *testing.T, content string, prev *exposeState) *exposeState {
+	t.Helper()
+	writeConfig(t, content)
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, err := newExposeState(cfg, prev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return state
+}
+
+func TestReloadKeepsPreviousConfig(t *testing.T) {
+	dir := useConfigDir(t)
+	logs := captureLogs(t)
+
+	certFile, keyFile := writeCertificate(t, dir, testCertificate(t, time.Now().Add(time.Hour), "default.invalid"))
+	valid := "[domains]\na.test=8080\n\n[certificates]\ndefault = " + certFile + ", " + keyFile + "\n"
+	state := loadState(t, valid, nil)
+	current.Store(state)
+	t.Cleanup(func() { current.Store(nil) })
+
+	tests := []struct {
+		name   string
+		config string
+	}{
+		{name: "syntax error", config: "[domains]\na.test\n"},
+		{name: "no domains", config: "[redirects]\na.test -> https://b.test\n"},
+		{name: "invalid port", config: "[domains]\na.test=80:80\n"},
+		{name: "missing certificate", config: "[domains]\na.test=8080\n\n[certificates]\ndefault = missing.crt, missing.key\n"},
+		{name: "invalid redirect code", config: "[domains]\na.test=8080\n\n[redirects]\na.test -> https://b.test 200\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := len(logs())
+			writeConfig(t, tt.config)
+			reload("file")
+
+			got := current.Load()
+			if got.config != state.config || got.routes != state.routes || got.certs != state.certs {
+				t.Fatal("failed reload replaced the running config")
+			}
+			if got.routes.target("a.test") != "8080" {
+				t.Errorf("a.test routes to %q, want 8080", got.routes.target("a.test"))
+			}
+
+			// Os stamps novos evitam repetir o mesmo erro a cada ciclo
+			if stamps := fileStamps(got.config.watchedFiles()); got.stamps[configPath] != stamps[configPath] {
+				t.Error("stamps of the failed file were not kept")
+			}
+
+			records := logs()[before:]
+			if len(records) != 1 || records[0]["level"] != "ERROR" || records[0]["trigger"] != "file" {
+				t.Errorf("logged %v, want one ERROR record", records)
+			}
+		})
+	}
+
+	// Um arquivo válido volta a ser aplicado
+	writeConfig(t, "[domains]\na.test=9090\n\n[certificates]\ndefault = "+certFile+", "+keyFile+"\n")
+	reload("signal")
+	if target := current.Load().routes.target("a.test"); target != "9090" {
+		t.Errorf("a.test routes to %q after a valid reload, want 9090", target)
+	}
+}
+
+func TestLogReload(t *testing.T) {
+	dir := useConfigDir(t)
+	logs := captureLogs(t)
+
+	expires := time.Now().Add(time.Hour)
+	defaultCert, defaultKey := writeCertificate(t, dir, testCertificate(t, expires, "default.invalid"))
+	appCert, appKey := writeCertificate(t, dir, testCertificate(t, expires, "app.test"))
+
+	base := "[domains]\na.test=8080\nb.test=8080\n\n[redirects]\nold.test -> https://a.test\n\n[certificates]\ndefault = " + defaultCert + ", " + defaultKey + "\n"
+
+	tests := []struct {
+		name   string
+		next   string
+		change func(t *testing.T) // Alteração em disco antes do reload
+		want   map[string]string
+	}{
+		{
+			name: "no changes",
+			next: base,
+			want: map[string]string{"changes": "none"},
+		},
+		{
+			name: "domains",
+			next: "[domains]\nb.test=9090\nc.test=8081\n\n[redirects]\nold.test -> https://a.test\n\n[certificates]\ndefault = " + defaultCert + ", " + defaultKey + "\n",
+			want: map[string]string{
+				"domains_added":   "c.test=8081",
+				"domains_removed": "a.test",
+				"domains_changed": "b.test=8080->9090",
+			},
+		},
+		{
+			name: "redirects",
+			next: "[domains]\na.test=8080\nb.test=8080\n\n[redirects]\nnew.test -> https://b.test 302\n\n[certificates]\ndefault = " + defaultCert + ", " + defaultKey + "\n",
+			want: map[string]string{
+				"redirects_added":   "new.test -> https://b.test 302",
+				"redirects_removed": "old.test -> https://a.test",
+			},
+		},
+		{
+			name: "certificate added",
+			next: base + "app.test = " + appCert + ", " + appKey + "\n",
+			want: map[string]string{"certificates_added": "app.test"},
+		},
+		{
+			name: "certificate renewed in place",
+			next: base,
+			change: func(t *testing.T) {
+				renewed := testCertificate(t, expires.Add(time.Hour), "default.invalid")
+				certFile, keyFile := writeCertificate(t, t.TempDir(), renewed)
+				for src, dst := range map[string]string{certFile: defaultCert, keyFile: defaultKey} {
+					data, err := os.ReadFile(src)
+					if err != nil {
+						t.Fatal(err)
+					}
+					touch(t, dst, string(data))
+				}
+			},
+			want: map[string]string{"certificates_changed": "default"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prev := loadState(t, base, nil)
+			if tt.change != nil {
+				tt.change(t)
+			}
+			next := loadState(t, tt.next, prev)
+
+			before := len(logs())
+			logReload("signal", prev, next)
+			records := logs()[before:]
+			if len(records) != 1 {
+				t.Fatalf("logged %d records, want 1", len(records))
+			}
+			record := records[0]
+
+			if record["msg"] != "Expose config reloaded" || record["trigger"] != "signal" {
+				t.Errorf("record = %v", record)
+			}
+			for key, want := range tt.want {
+				if got := record[key]; got != want {
+					t.Errorf("%s = %v, want %q", key, got, want)
+				}
+			}
+			// Nada além do que mudou entra no log
+			for key := range record {
+				switch key {
+				case "time", "level", "msg", "trigger":
+					continue
+				}
+				if _, ok := tt.want[key]; !ok {
+					t.Errorf("unexpected %s = %v", key, record[key])
+				}
+			}
+		})
+	}
+}
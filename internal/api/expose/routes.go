@@ -0,0 +1,119 @@
+package expose
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// upstreamTransport is shared by every proxy so connections to the local
+// services stay pooled across requests and reloads.
+var upstreamTransport = &http.Transport{
+	DialContext: (&net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}).DialContext,
+	ForceAttemptHTTP2:     true,
+	MaxIdleConns:          512,
+	MaxIdleConnsPerHost:   128,
+	IdleConnTimeout:       90 * time.Second,
+	ExpectContinueTimeout: time.Second,
+}
+
+func newReverseProxy(target string) (*httputil.ReverseProxy, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+	proxy := httputil.NewSingleHostReverseProxy(u)
+	proxy.Transport = upstreamTransport
+	return proxy, nil
+}
+
+// routeTable is the compiled [domains] section. Exact names win over
+// wildcards, and among wildcards the longest suffix wins, so the result no
+// longer depends on map order.
+type routeTable struct {
+	exact     map[string]*httputil.ReverseProxy
+	wildcards map[string]*httputil.ReverseProxy // "*.tunnerse.com" indexado por "tunnerse.com"
+	proxies   map[string]*httputil.ReverseProxy // Alvo -> proxy usado por esta tabela
+}
+
+// compileRoutes builds the table for routes. Proxies of prev whose target is
+// still routed are reused, the others go away with the old table. Names that
+// only differ in case keep the first one in sorted order.
+func compileRoutes(routes map[string]string, prev *routeTable) (*routeTable, error) {
+	table := &routeTable{
+		exact:     make(map[string]*httputil.ReverseProxy),
+		wildcards: make(map[string]*httputil.ReverseProxy),
+		proxies:   make(map[string]*httputil.ReverseProxy),
+	}
+
+	domains := make([]string, 0, len(routes))
+	for domain := range routes {
+		domains = append(domains, domain)
+	}
+	sort.Strings(domains)
+
+	seen := make(map[string]bool, len(domains))
+	for _, name := range domains {
+		domain := strings.ToLower(name)
+		if seen[domain] {
+			continue
+		}
+		seen[domain] = true
+
+		proxy, err := table.proxy(fmt.Sprintf("http://localhost:%s", routes[name]), prev)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port for %s: %w", domain, err)
+		}
+
+		if base, ok := strings.CutPrefix(domain, "*."); ok {
+			table.wildcards[base] = proxy
+		} else {
+			table.exact[domain] = proxy
+		}
+	}
+	return table, nil
+}
+
+// proxy returns the proxy for target, shared by every domain of the table
+// that points to it and taken from prev when it already had one.
+func (t *routeTable) proxy(target string, prev *routeTable) (*httputil.ReverseProxy, error) {
+	if proxy, ok := t.proxies[target]; ok {
+		return proxy, nil
+	}
+	if prev != nil {
+		if proxy, ok := prev.proxies[target]; ok {
+			t.proxies[target] = proxy
+			return proxy, nil
+		}
+	}
+	proxy, err := newReverseProxy(target)
+	if err != nil {
+		return nil, err
+	}
+	t.proxies[target] = proxy
+	return proxy, nil
+}
+
+// lookup returns the proxy for host, or nil. A wildcard also answers its
+// base name when there is no exact entry for it.
+func (t *routeTable) lookup(host string) *httputil.ReverseProxy {
+	if proxy, ok := t.exact[host]; ok {
+		return proxy
+	}
+	// tira um rótulo por vez, então o sufixo mais longo é testado primeiro
+	for suffix := host; suffix != ""; {
+		if proxy, ok := t.wildcards[suffix]; ok {
+			return proxy
+		}
+		_, suffix, _ = strings.Cut(suffix, ".")
+	}
+	return nil
+}
@@ -0,0 +1,253 @@
+package expose
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func mustCompileRoutes(t testing.TB, routes map[string]string, prev *routeTable) *routeTable {
+	t.Helper()
+	table, err := compileRoutes(routes, prev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return table
+}
+
+// target returns the port the proxy of host points to, or "" without one.
+func (table *routeTable) target(host string) string {
+	proxy := table.lookup(host)
+	for target, p := range table.proxies {
+		if p == proxy {
+			return strings.TrimPrefix(target, "http://localhost:")
+		}
+	}
+	return ""
+}
+
+func TestRouteTableLookup(t *testing.T) {
+	tests := []struct {
+		name   string
+		routes map[string]string
+		host   string
+		want   string
+	}{
+		{
+			name:   "exact",
+			routes: map[string]string{"tunnerse.com": "1"},
+			host:   "tunnerse.com",
+			want:   "1",
+		},
+		{
+			name:   "exact beats wildcard",
+			routes: map[string]string{"api.tunnerse.com": "1", "*.tunnerse.com": "2"},
+			host:   "api.tunnerse.com",
+			want:   "1",
+		},
+		{
+			name:   "wildcard answers other names",
+			routes: map[string]string{"api.tunnerse.com": "1", "*.tunnerse.com": "2"},
+			host:   "shop.tunnerse.com",
+			want:   "2",
+		},
+		{
+			name:   "wildcard answers its base",
+			routes: map[string]string{"*.tunnerse.com": "2"},
+			host:   "tunnerse.com",
+			want:   "2",
+		},
+		{
+			name:   "exact base beats wildcard",
+			routes: map[string]string{"tunnerse.com": "1", "*.tunnerse.com": "2"},
+			host:   "tunnerse.com",
+			want:   "1",
+		},
+		{
+			name:   "wildcard covers deeper names",
+			routes: map[string]string{"*.tunnerse.com": "2"},
+			host:   "a.b.tunnerse.com",
+			want:   "2",
+		},
+		{
+			name:   "longest suffix wins",
+			routes: map[string]string{"*.com": "1", "*.tunnerse.com": "2", "*.api.tunnerse.com": "3"},
+			host:   "v1.api.tunnerse.com",
+			want:   "3",
+		},
+		{
+			name:   "shorter suffix when the longer does not match",
+			routes: map[string]string{"*.com": "1", "*.tunnerse.com": "2", "*.api.tunnerse.com": "3"},
+			host:   "shop.tunnerse.com",
+			want:   "2",
+		},
+		{
+			name:   "suffix must be a whole label",
+			routes: map[string]string{"*.tunnerse.com": "2"},
+			host:   "eviltunnerse.com",
+			want:   "",
+		},
+		{
+			name:   "config names are case insensitive",
+			routes: map[string]string{"API.Tunnerse.com": "1", "*.TUNNERSE.com": "2"},
+			host:   "api.tunnerse.com",
+			want:   "1",
+		},
+		{
+			name:   "unknown host",
+			routes: map[string]string{"tunnerse.com": "1"},
+			host:   "other.com",
+			want:   "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table := mustCompileRoutes(t, tt.routes, nil)
+			if got := table.target(tt.host); got != tt.want {
+				t.Errorf("lookup(%q) = %q, want %q", tt.host, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileRoutesStableTieBreak(t *testing.T) {
+	routes := map[string]string{
+		"api.tunnerse.com": "1", "API.tunnerse.com": "2", "Api.Tunnerse.com": "3",
+		"*.tunnerse.com": "4", "*.Tunnerse.com": "5", "*.TUNNERSE.COM": "6",
+	}
+
+	// A ordem do map muda a cada compilação; o vencedor não pode mudar
+	for i := 0; i < 50; i++ {
+		table := mustCompileRoutes(t, routes, nil)
+		if got := table.target("api.tunnerse.com"); got != "2" {
+			t.Fatalf("run %d: exact duplicate resolved to %q, want the first sorted name", i, got)
+		}
+		if got := table.target("shop.tunnerse.com"); got != "6" {
+			t.Fatalf("run %d: wildcard duplicate resolved to %q, want the first sorted name", i, got)
+		}
+		if len(table.wildcards) != 1 {
+			t.Fatalf("run %d: %d wildcards, want duplicates dropped", i, len(table.wildcards))
+		}
+	}
+}
+
+func TestCompileRoutesProxyPool(t *testing.T) {
+	first := mustCompileRoutes(t, map[string]string{"a.com": "1", "b.com": "2", "*.b.com": "2"}, nil)
+	if len(first.proxies) != 2 || first.lookup("b.com") != first.lookup("x.b.com") {
+		t.Fatalf("proxies = %d, want one per target shared by its domains", len(first.proxies))
+	}
+
+	// O reload mantém o proxy do alvo que ficou e solta o do alvo removido
+	second := mustCompileRoutes(t, map[string]string{"b.com": "2", "c.com": "3"}, first)
+	if second.lookup("b.com") != first.lookup("b.com") {
+		t.Error("proxy of a kept target was rebuilt")
+	}
+	if _, ok := second.proxies["http://localhost:1"]; ok {
+		t.Error("proxy of a removed target was kept")
+	}
+	if len(second.proxies) != 2 {
+		t.Errorf("proxies after reload = %d, want 2", len(second.proxies))
+	}
+
+	// Um alvo que volta depois de removido ganha um proxy novo
+	third := mustCompileRoutes(t, map[string]string{"a.com": "1"}, second)
+	if third.lookup("a.com") == first.lookup("a.com") {
+		t.Error("proxy of a removed target came back from an older table")
+	}
+}
+
+// linearLookup is the matching used before routes were compiled: it walks the
+// config map and builds a new proxy for every request.
+func linearLookup(routes map[string]string, host string) *httputil.ReverseProxy {
+	for domain, port := range routes {
+		domain = strings.ToLower(domain)
+		if base, ok := strings.CutPrefix(domain, "*."); ok {
+			if strings.HasSuffix(host, "."+base) || host == base {
+				u, _ := url.Parse(fmt.Sprintf("http://localhost:%s", port))
+				return httputil.NewSingleHostReverseProxy(u)
+			}
+		} else if host == domain {
+			u, _ := url.Parse(fmt.Sprintf("http://localhost:%s", port))
+			return httputil.NewSingleHostReverseProxy(u)
+		}
+	}
+	return nil
+}
+
+// benchRoutes has n exact names and n wildcards, all on port, and a host that
+// only the last wildcard answers.
+func benchRoutes(n int, port string) (map[string]string, string) {
+	routes := make(map[string]string, 2*n)
+	for i := 0; i < n; i++ {
+		routes[fmt.Sprintf("app%d.tunnerse.com", i)] = port
+		routes[fmt.Sprintf("*.user%d.tunnerse.com", i)] = port
+	}
+	return routes, fmt.Sprintf("shop.user%d.tunnerse.com", n-1)
+}
+
+func BenchmarkLookup(b *testing.B) {
+	for _, n := range []int{10, 100, 1000} {
+		routes, host := benchRoutes(n, "8080")
+
+		b.Run(fmt.Sprintf("linear/%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if linearLookup(routes, host) == nil {
+					b.Fatal("no route")
+				}
+			}
+		})
+
+		b.Run(fmt.Sprintf("table/%d", n), func(b *testing.B) {
+			table := mustCompileRoutes(b, routes, nil)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if table.lookup(host) == nil {
+					b.Fatal("no route")
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkHandler(b *testing.B) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer upstream.Close()
+	u, _ := url.Parse(upstream.URL)
+
+	for _, n := range []int{10, 1000} {
+		routes, host := benchRoutes(n, u.Port())
+
+		b.Run(fmt.Sprintf("linear/%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				w := httptest.NewRecorder()
+				r := httptest.NewRequest(http.MethodGet, "http://"+host+"/", nil)
+				linearLookup(routes, host).ServeHTTP(w, r)
+				if w.Code != http.StatusOK {
+					b.Fatalf("status = %d", w.Code)
+				}
+			}
+		})
+
+		b.Run(fmt.Sprintf("table/%d", n), func(b *testing.B) {
+			useState(b, &exposeState{
+				config: &exposeConfig{routes: routes},
+				routes: mustCompileRoutes(b, routes, nil),
+			})
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				w := httptest.NewRecorder()
+				handler(w, httptest.NewRequest(http.MethodGet, "http://"+host+"/", nil))
+				if w.Code != http.StatusOK {
+					b.Fatalf("status = %d", w.Code)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"runtime"
+	"sync"
+)
+
+// consoleHandler writes the colored, human oriented layout the server has
+// always printed: a timestamp, the level and one indented line per detail.
+type consoleHandler struct {
+	w      io.Writer
+	level  slog.Level
+	colors bool
+	attrs  []slog.Attr
+	prefix string
+	mu     *sync.Mutex
+}
+
+func newConsoleHandler(w io.Writer, level slog.Level) *consoleHandler {
+	return &consoleHandler{w: w, level: level, colors: true, mu: &sync.Mutex{}}
+}
+
+func newPlainConsoleHandler(w io.Writer, level slog.Level) *consoleHandler {
+	return &consoleHandler{w: w, level: level, mu: &sync.Mutex{}}
+}
+
+func (h *consoleHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level
+}
+
+func (h *consoleHandler) Handle(_ context.Context, record slog.Record) error {
+	name := levelName(record.Level)
+	color, reset := getLevelColor(name), "\033[0m"
+	if !h.colors {
+		color, reset = "", ""
+	}
+	timestamp := record.Time.Format("2006/01/02 15:04:05")
+
+	var buf bytes.Buffer
+	if record.Level <= slog.LevelDebug && record.PC != 0 {
+		frame, _ := runtime.CallersFrames([]uintptr{record.PC}).Next()
+		fmt.Fprintf(&buf, "%s %s%s:%d%s \n↳ %s%s%s - %s\n",
+			timestamp, color, frame.File, frame.Line, reset,
+			color, name, reset, record.Message)
+	} else {
+		fmt.Fprintf(&buf, "%s \n↳ %s%s%s - %s\n",
+			timestamp, color, name, reset, record.Message)
+	}
+
+	write := func(attr slog.Attr) bool {
+		fmt.Fprintf(&buf, "	%s%s%s: %v\n", color, h.prefix+attr.Key, reset, attr.Value.Resolve())
+		return true
+	}
+	for _, attr := range h.attrs {
+		write(attr)
+	}
+	record.Attrs(write)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := h.w.Write(buf.Bytes())
+	return err
+}
+
+func (h *consoleHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clone := *h
+	clone.attrs = append([]slog.Attr(nil), h.attrs...)
+	for _, attr := range attrs {
+		attr.Key = h.prefix + attr.Key
+		clone.attrs = append(clone.attrs, attr)
+	}
+	return &clone
+}
+
+func (h *consoleHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	clone := *h
+	clone.prefix = h.prefix + name + "."
+	return &clone
+}
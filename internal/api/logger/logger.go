@@ -1,11 +1,10 @@
 package logger
 
 import (
-	"fmt"
+	"context"
+	"log/slog"
 	"runtime"
 	"time"
-
-	"github.com/pedroborgesdev/tunnerse-api/internal/api/debug"
 )
 
 type LogDetail struct {
@@ -13,36 +12,23 @@ type LogDetail struct {
 	Value interface{}
 }
 
+// Log keeps the original call style on top of slog. Free-form levels such as
+// "ENV" are mapped by ParseLevel; details become record attributes.
 func Log(level string, message string, details []LogDetail) {
-	if !debug.DebugConfig.Debug && level == "DEBUG" {
+	lvl := ParseLevel(level)
+	handler := current()
+	if !handler.Enabled(context.Background(), lvl) {
 		return
 	}
 
-	_, file, line, ok := runtime.Caller(1)
-	if !ok {
-		file = "unknown"
-		line = 0
-	}
-
-	timestamp := time.Now().Format("2006/01/02 15:04:05")
-	color := getLevelColor(level)
-	reset := "\033[0m"
-
-	var consoleMsg string
-	if level == "DEBUG" {
-		consoleMsg = fmt.Sprintf("%s %s%s:%d%s \n↳ %s%s%s - %s\n",
-			timestamp, color, file, line, reset,
-			color, level, reset, message)
-	} else {
-		consoleMsg = fmt.Sprintf("%s \n↳ %s%s%s - %s\n",
-			timestamp, color, level, reset, message)
-	}
-
-	fmt.Print(consoleMsg)
+	var pcs [1]uintptr
+	runtime.Callers(2, pcs[:]) // Ignora runtime.Callers e Log
 
+	record := slog.NewRecord(time.Now(), lvl, message, pcs[0])
 	for _, detail := range details {
-		fmt.Printf("	%s%s%s: %v\n", color, detail.Key, reset, detail.Value)
+		record.AddAttrs(slog.Any(detail.Key, detail.Value))
 	}
+	_ = handler.Handle(context.Background(), record)
 }
 
 func getLevelColor(level string) string {
@@ -0,0 +1,212 @@
+package logger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/debug"
+)
+
+// LevelEnv is used by the startup dump of the environment, shown between
+// INFO and WARN.
+const LevelEnv = slog.Level(2)
+
+type Options struct {
+	Level      string // DEBUG, INFO, WARN ou ERROR; vazio segue a flag DEBUG
+	Format     string // console, text ou json
+	File       string // Arquivo adicional, vazio desativa
+	FileFormat string // Formato usado no arquivo, json por padrão
+	MaxSize    int64  // Tamanho em bytes que dispara a rotação
+	MaxBackups int    // Arquivos rotacionados mantidos
+	Stdout     bool   // Mantém a saída no terminal junto com o arquivo
+}
+
+var (
+	active   atomic.Pointer[slog.Handler]
+	rotating *rotatingFile
+)
+
+// current returns the configured handler or, before Setup, the colored
+// console output gated by the DEBUG flag as it always was.
+func current() slog.Handler {
+	if h := active.Load(); h != nil {
+		return *h
+	}
+	level := slog.LevelInfo
+	if debug.DebugConfig.Debug {
+		level = slog.LevelDebug
+	}
+	return newConsoleHandler(os.Stdout, level)
+}
+
+// Setup replaces the output of Log and of slog.Default.
+func Setup(opts Options) error {
+	level := slog.LevelInfo
+	if debug.DebugConfig.Debug {
+		level = slog.LevelDebug
+	}
+	if opts.Level != "" {
+		parsed, ok := parseLevel(opts.Level)
+		if !ok {
+			return fmt.Errorf("invalid log level: %s", opts.Level)
+		}
+		level = parsed
+	}
+
+	var handlers []slog.Handler
+	var file *rotatingFile
+	if opts.File == "" || opts.Stdout {
+		h, err := newHandler(opts.Format, os.Stdout, level, true)
+		if err != nil {
+			return err
+		}
+		handlers = append(handlers, h)
+	}
+
+	if opts.File != "" {
+		var err error
+		file, err = openRotatingFile(opts.File, opts.MaxSize, opts.MaxBackups)
+		if err != nil {
+			return err
+		}
+		format := opts.FileFormat
+		if format == "" {
+			format = "json"
+		}
+		h, err := newHandler(format, file, level, false)
+		if err != nil {
+			file.Close()
+			return err
+		}
+		handlers = append(handlers, h)
+	}
+
+	var handler slog.Handler = fanout(handlers)
+	if len(handlers) == 1 {
+		handler = handlers[0]
+	}
+	active.Store(&handler)
+	slog.SetDefault(slog.New(handler))
+
+	// O arquivo anterior só é fechado depois que ninguém mais escreve nele
+	if rotating != nil {
+		rotating.Close()
+	}
+	rotating = file
+	return nil
+}
+
+// Close flushes and closes the log file, if any.
+func Close() error {
+	if rotating == nil {
+		return nil
+	}
+	return rotating.Close()
+}
+
+func newHandler(format string, w io.Writer, level slog.Level, colors bool) (slog.Handler, error) {
+	opts := &slog.HandlerOptions{
+		Level:       level,
+		AddSource:   level <= slog.LevelDebug,
+		ReplaceAttr: replaceLevel,
+	}
+	switch strings.ToLower(format) {
+	case "", "console":
+		if !colors {
+			return newPlainConsoleHandler(w, level), nil
+		}
+		return newConsoleHandler(w, level), nil
+	case "text":
+		return slog.NewTextHandler(w, opts), nil
+	case "json":
+		return slog.NewJSONHandler(w, opts), nil
+	default:
+		return nil, fmt.Errorf("invalid log format: %s", format)
+	}
+}
+
+// ParseLevel maps the level names used across the code base; unknown names
+// are logged as INFO.
+func ParseLevel(name string) slog.Level {
+	level, ok := parseLevel(name)
+	if !ok {
+		return slog.LevelInfo
+	}
+	return level
+}
+
+func parseLevel(name string) (slog.Level, bool) {
+	switch strings.ToUpper(name) {
+	case "DEBUG":
+		return slog.LevelDebug, true
+	case "INFO":
+		return slog.LevelInfo, true
+	case "ENV":
+		return LevelEnv, true
+	case "WARN", "WARNING":
+		return slog.LevelWarn, true
+	case "ERROR":
+		return slog.LevelError, true
+	}
+	return 0, false
+}
+
+func levelName(level slog.Level) string {
+	if level == LevelEnv {
+		return "ENV"
+	}
+	return level.String()
+}
+
+func replaceLevel(groups []string, attr slog.Attr) slog.Attr {
+	if len(groups) == 0 && attr.Key == slog.LevelKey {
+		if level, ok := attr.Value.Any().(slog.Level); ok {
+			attr.Value = slog.StringValue(levelName(level))
+		}
+	}
+	return attr
+}
+
+// fanout sends every record to all sinks.
+type fanout []slog.Handler
+
+func (f fanout) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, h := range f {
+		if h.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f fanout) Handle(ctx context.Context, record slog.Record) error {
+	var errs []error
+	for _, h := range f {
+		if h.Enabled(ctx, record.Level) {
+			errs = append(errs, h.Handle(ctx, record.Clone()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (f fanout) WithAttrs(attrs []slog.Attr) slog.Handler {
+	out := make(fanout, len(f))
+	for i, h := range f {
+		out[i] = h.WithAttrs(attrs)
+	}
+	return out
+}
+
+func (f fanout) WithGroup(name string) slog.Handler {
+	out := make(fanout, len(f))
+	for i, h := range f {
+		out[i] = h.WithGroup(name)
+	}
+	return out
+}
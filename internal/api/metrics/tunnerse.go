@@ -0,0 +1,87 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// DefaultBuckets cover from a local round trip to TUNNEL_REQUEST_TIMEOUT.
+var DefaultBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+var startedAt = time.Now()
+
+var (
+	TunnelsActive = factory.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "tunnerse_tunnels_active",
+		Help: "Tunnels currently registered.",
+	}, []string{"type"})
+	Registrations = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "tunnerse_registrations_total",
+		Help: "Tunnels registered since the server started.",
+	}, []string{"type"})
+
+	Requests = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "tunnerse_requests_total",
+		Help: "Public requests relayed, by status class (error when no status was sent).",
+	}, []string{"tunnel", "class"})
+	PendingRequests = factory.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "tunnerse_pending_requests",
+		Help: "Requests waiting for the agent or for its response.",
+	}, []string{"tunnel"})
+	Timeouts = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "tunnerse_timeouts_total",
+		Help: "Requests that timed out waiting for the agent.",
+	}, []string{"tunnel"})
+	LocalAPIErrors = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "tunnerse_local_api_errors_total",
+		Help: "Requests the agent could not deliver to the local API.",
+	}, []string{"tunnel"})
+
+	QueueWait = factory.NewHistogram(prometheus.HistogramOpts{
+		Name:    "tunnerse_request_queue_seconds",
+		Help:    "Time a request waited on requestCh until the agent took it.",
+		Buckets: DefaultBuckets,
+	})
+	ResponseWait = factory.NewHistogram(prometheus.HistogramOpts{
+		Name:    "tunnerse_response_wait_seconds",
+		Help:    "Time from the agent taking a request until its response was relayed.",
+		Buckets: DefaultBuckets,
+	})
+
+	BytesIn = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "tunnerse_bytes_in_total",
+		Help: "Bytes received from public clients.",
+	}, []string{"tunnel"})
+	BytesOut = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "tunnerse_bytes_out_total",
+		Help: "Bytes sent back to public clients.",
+	}, []string{"tunnel"})
+
+	_ = factory.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "tunnerse_start_time_seconds",
+		Help: "Unix time the server started.",
+	}, func() float64 { return float64(startedAt.Unix()) })
+)
+
+// tunnelVecs are the families labeled by tunnel, dropped by ForgetTunnel.
+var tunnelVecs = []interface {
+	DeletePartialMatch(labels prometheus.Labels) int
+}{Requests, PendingRequests, Timeouts, LocalAPIErrors, BytesIn, BytesOut}
+
+// StatusClass groups a response status as 2xx, 3xx... or error when the
+// request failed before a status was sent.
+func StatusClass(status int) string {
+	if status < 100 || status > 599 {
+		return "error"
+	}
+	return string(rune('0'+status/100)) + "xx"
+}
+
+// ForgetTunnel drops the series of a closed tunnel, so they do not pile up
+// in the output.
+func ForgetTunnel(name string) {
+	for _, vec := range tunnelVecs {
+		vec.DeletePartialMatch(prometheus.Labels{"tunnel": name})
+	}
+}
@@ -1,135 +1,139 @@
 package middlewares
 
 import (
-	"net/http"
-	"sync"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strconv"
 	"time"
 
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/config"
 	"github.com/pedroborgesdev/tunnerse-api/internal/api/logger"
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/utils"
 
 	"github.com/gin-gonic/gin"
 )
 
-type ipInfo struct {
-	count     int
-	lastSeen  time.Time
-	warnCount int
-	blocked   bool
-	blockTime time.Time
-	resetTime time.Time
+// RateLimitRule is one token bucket: Limit requests may burst at once and the
+// bucket refills Limit tokens every Window. Requests whose Key is empty are
+// not counted by the rule.
+type RateLimitRule struct {
+	Name   string
+	Limit  int
+	Window time.Duration
+	Key    func(c *gin.Context) string
 }
 
-type RateLimiterConfig struct {
-	RequestLimit     int
-	WindowMinutes    int
-	WarningThreshold int
-	BlockTimeout     int
-}
-
-var (
-	ips             = make(map[string]map[string]*ipInfo)
-	mu              sync.RWMutex
-	cleanupInterval = 30 * time.Minute
-	maxInactiveTime = 2 * time.Hour
-)
-
-func RateLimiter(config RateLimiterConfig) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		ip := c.ClientIP()
-		route := c.FullPath()
-
-		mu.Lock()
-		defer mu.Unlock()
-
-		if _, exists := ips[ip]; !exists {
-			ips[ip] = make(map[string]*ipInfo)
+// RateLimiter enforces every rule on the request and answers 429 as soon as
+// one of them runs out of tokens. The RateLimit-* headers describe the most
+// restrictive rule. When the store fails the request is let through.
+func RateLimiter(store LimiterStore, rules ...RateLimitRule) gin.HandlerFunc {
+	active := make([]RateLimitRule, 0, len(rules))
+	for _, rule := range rules {
+		if rule.Limit > 0 && rule.Window > 0 {
+			active = append(active, rule)
 		}
+	}
+	if store == nil || len(active) == 0 {
+		return func(c *gin.Context) { c.Next() }
+	}
 
-		info, exists := ips[ip][route]
-		if !exists {
-			info = &ipInfo{
-				resetTime: time.Now().Add(time.Duration(config.WindowMinutes) * time.Minute),
+	return func(c *gin.Context) {
+		var (
+			tightest *RateLimitDecision
+			policy   RateLimitRule
+		)
+
+		for _, rule := range active {
+			key := rule.Key(c)
+			if key == "" {
+				continue
 			}
-			ips[ip][route] = info
-		}
 
-		if time.Now().After(info.resetTime) {
-			info.count = 0
-			info.warnCount = 0
-			info.blocked = false
-			info.resetTime = time.Now().Add(time.Duration(config.WindowMinutes) * time.Minute)
+			d, err := store.Take(c.Request.Context(), rule.Name+":"+key, rule.Limit, rule.Window)
+			if err != nil {
+				logger.Log("ERROR", "Rate limit store failed", []logger.LogDetail{
+					{Key: "limit", Value: rule.Name},
+					{Key: "Error", Value: err.Error()},
+				})
+				continue
+			}
+			if tightest == nil || !d.Allowed || d.Remaining < tightest.Remaining {
+				tightest, policy = &d, rule
+			}
+			if !d.Allowed {
+				break
+			}
 		}
 
-		if info.blocked {
-			if time.Since(info.blockTime) < time.Duration(config.BlockTimeout)*time.Minute {
-				respondWithBlock(c, ip, route, config.BlockTimeout)
-				return
-			}
-			info.blocked = false
-			info.count = 0
-			info.warnCount = 0
+		if tightest == nil {
+			c.Next()
+			return
 		}
 
-		if info.count >= config.RequestLimit {
-			info.warnCount++
-			if info.warnCount >= config.WarningThreshold {
-				info.blocked = true
-				info.blockTime = time.Now()
-				respondWithBlock(c, ip, route, config.BlockTimeout)
-				return
-			}
-			respondWithWarning(c, ip, route, info.warnCount)
+		header := c.Writer.Header()
+		header.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", policy.Limit, int(policy.Window.Seconds())))
+		header.Set("RateLimit-Limit", strconv.Itoa(tightest.Limit))
+		header.Set("RateLimit-Remaining", strconv.Itoa(tightest.Remaining))
+		header.Set("RateLimit-Reset", strconv.Itoa(seconds(tightest.Reset)))
+
+		if !tightest.Allowed {
+			retry := seconds(tightest.Retry)
+			header.Set("Retry-After", strconv.Itoa(retry))
+			utils.TooManyRequests(c, gin.H{
+				"error":       "rate limit exceeded",
+				"limit":       policy.Name,
+				"retry_after": retry,
+			})
+			logger.Log("WARN", "Rate limit exceeded", []logger.LogDetail{
+				{Key: "ip", Value: c.ClientIP()},
+				{Key: "limit", Value: policy.Name},
+				{Key: "path", Value: c.Request.URL.Path},
+			})
 			return
 		}
 
-		info.count++
-		info.lastSeen = time.Now()
 		c.Next()
 	}
 }
 
-func respondWithBlock(c *gin.Context, ip, route string, timeout int) {
-	c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
-		"error":   "Blocked for excessive requests",
-		"timeout": timeout,
-	})
-	logger.Log("WARN", "IP blocked for route", []logger.LogDetail{
-		{Key: "IP", Value: ip},
-		{Key: "Route", Value: route},
-		{Key: "Timeout", Value: timeout},
-	})
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
 }
 
-func respondWithWarning(c *gin.Context, ip, route string, warnCount int) {
-	c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
-		"error": "Too many requests - warning issued",
-		"warns": warnCount,
-	})
-	logger.Log("WARN", "Too many requests for route", []logger.LogDetail{
-		{Key: "IP", Value: ip},
-		{Key: "Route", Value: route},
-		{Key: "Warns", Value: warnCount},
-	})
+func ClientIPKey(c *gin.Context) string {
+	return c.ClientIP()
 }
 
-func cleanup() {
-	for {
-		time.Sleep(cleanupInterval)
-		mu.Lock()
-		for ip, routes := range ips {
-			for route, info := range routes {
-				if time.Since(info.lastSeen) > maxInactiveTime {
-					delete(routes, route)
-				}
-			}
-			if len(routes) == 0 {
-				delete(ips, ip)
-			}
-		}
-		mu.Unlock()
+func TunnelNameKey(c *gin.Context) string {
+	return utils.GetTunnelName(c)
+}
+
+// APIKeyKey identifies the caller by a hash of its api key, so the raw key is
+// never kept in the limiter.
+func APIKeyKey(c *gin.Context) string {
+	key := c.GetHeader("Tunnerse-Api-Key")
+	if key == "" {
+		return ""
 	}
+	return hex.EncodeToString(utils.HashSecret(key))
+}
+
+// PublicRateLimiter limits the traffic that reaches tunnels through their
+// public URL.
+func PublicRateLimiter(store LimiterStore) gin.HandlerFunc {
+	window := time.Duration(config.AppConfig.RATE_LIMIT_WINDOW) * time.Second
+	return RateLimiter(store,
+		RateLimitRule{Name: "ip", Limit: config.AppConfig.RATE_LIMIT_IP, Window: window, Key: ClientIPKey},
+		RateLimitRule{Name: "tunnel", Limit: config.AppConfig.RATE_LIMIT_TUNNEL, Window: window, Key: TunnelNameKey},
+	)
 }
 
-func init() {
-	go cleanup()
+// RegisterRateLimiter limits tunnel registrations per client and per api key.
+func RegisterRateLimiter(store LimiterStore) gin.HandlerFunc {
+	window := time.Duration(config.AppConfig.RATE_LIMIT_WINDOW) * time.Second
+	return RateLimiter(store,
+		RateLimitRule{Name: "register-ip", Limit: config.AppConfig.RATE_LIMIT_REGISTER, Window: window, Key: ClientIPKey},
+		RateLimitRule{Name: "register-api-key", Limit: config.AppConfig.RATE_LIMIT_API_KEY, Window: window, Key: APIKeyKey},
+	)
 }
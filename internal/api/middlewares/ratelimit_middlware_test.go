@@ -0,0 +1,51 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/config"
+)
+
+func TestPublicRateLimiterPathMode(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	saved := config.AppConfig
+	t.Cleanup(func() { config.AppConfig = saved })
+	config.AppConfig.SUBDOMAIN = false
+	config.AppConfig.RATE_LIMIT_WINDOW = 60
+	config.AppConfig.RATE_LIMIT_IP = 0
+	config.AppConfig.RATE_LIMIT_TUNNEL = 1
+
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	limit := PublicRateLimiter(NewMemoryLimiterStore())
+
+	router := gin.New()
+	router.GET(":name/", limit, ok)
+	router.NoRoute(limit, ok)
+
+	// Os métodos sem nenhuma rota com :name caem no NoRoute sem o parâmetro
+	steps := []struct {
+		method string
+		path   string
+		want   int
+	}{
+		{http.MethodPut, "/demo/a", http.StatusOK},
+		{http.MethodPut, "/demo/b", http.StatusTooManyRequests},
+		{http.MethodDelete, "/demo", http.StatusTooManyRequests},
+		{http.MethodGet, "/demo/", http.StatusTooManyRequests},
+		{http.MethodPatch, "/other/a", http.StatusOK},
+		{http.MethodGet, "/other/deep/path", http.StatusTooManyRequests},
+	}
+
+	for _, step := range steps {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(step.method, step.path, nil))
+		if w.Code != step.want {
+			t.Errorf("%s %s = %d, want %d", step.method, step.path, w.Code, step.want)
+		}
+	}
+}
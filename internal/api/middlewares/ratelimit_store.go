@@ -0,0 +1,168 @@
+package middlewares
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// LimiterStore keeps the token buckets of the rate limiter. Stores shared by
+// several nodes make every node enforce the same quota.
+type LimiterStore interface {
+	// Take removes one token from the bucket identified by key, creating it
+	// full when it does not exist yet.
+	Take(ctx context.Context, key string, limit int, window time.Duration) (RateLimitDecision, error)
+}
+
+// RateLimitDecision is the outcome of taking a token from a bucket.
+type RateLimitDecision struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	Reset     time.Duration // Até o balde voltar a ficar cheio
+	Retry     time.Duration // Até o próximo token, quando negado
+}
+
+func newDecision(allowed bool, tokens float64, limit int, window time.Duration) RateLimitDecision {
+	rate := float64(limit) / window.Seconds()
+
+	d := RateLimitDecision{
+		Allowed:   allowed,
+		Limit:     limit,
+		Remaining: int(tokens),
+		Reset:     time.Duration((float64(limit) - tokens) / rate * float64(time.Second)),
+	}
+	if !allowed {
+		d.Retry = time.Duration((1 - tokens) / rate * float64(time.Second))
+	}
+	return d
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// MemoryLimiterStore keeps the buckets in process. Limits reset on restart
+// and are not shared between replicas.
+type MemoryLimiterStore struct {
+	buckets map[string]*bucket
+	mu      sync.Mutex
+}
+
+var (
+	cleanupInterval = 30 * time.Minute
+	maxInactiveTime = 2 * time.Hour
+)
+
+func NewMemoryLimiterStore() *MemoryLimiterStore {
+	s := &MemoryLimiterStore{buckets: make(map[string]*bucket)}
+	go s.cleanup()
+	return s
+}
+
+func (s *MemoryLimiterStore) Take(ctx context.Context, key string, limit int, window time.Duration) (RateLimitDecision, error) {
+	now := time.Now()
+	rate := float64(limit) / window.Seconds()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, exists := s.buckets[key]
+	if !exists {
+		b = &bucket{tokens: float64(limit), updated: now}
+		s.buckets[key] = b
+	}
+
+	b.tokens = math.Min(float64(limit), b.tokens+now.Sub(b.updated).Seconds()*rate)
+	b.updated = now
+
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+	return newDecision(allowed, b.tokens, limit, window), nil
+}
+
+func (s *MemoryLimiterStore) cleanup() {
+	for {
+		time.Sleep(cleanupInterval)
+		s.mu.Lock()
+		for key, b := range s.buckets {
+			if time.Since(b.updated) > maxInactiveTime {
+				delete(s.buckets, key)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+// takeScript refills and takes from the bucket atomically. The clock comes
+// from the Redis server so nodes with skewed clocks still agree. Scripts that
+// write after TIME need effects replication, the default from Redis 5 on and
+// enabled explicitly for 3.2 and 4.
+var takeScript = redis.NewScript(`
+redis.replicate_commands()
+
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'updated')
+local tokens = tonumber(state[1])
+local updated = tonumber(state[2])
+if tokens == nil or updated == nil then
+	tokens = limit
+	updated = now
+end
+
+tokens = math.min(limit, tokens + math.max(0, now - updated) * limit / window)
+
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'updated', now)
+redis.call('PEXPIRE', KEYS[1], window * 2)
+
+return {allowed, tostring(tokens)}
+`)
+
+// RedisLimiterStore keeps the buckets in Redis, so every node that points to
+// the same server enforces one global quota.
+type RedisLimiterStore struct {
+	client *redis.Client
+	prefix string
+}
+
+func NewRedisLimiterStore(client *redis.Client, prefix string) *RedisLimiterStore {
+	return &RedisLimiterStore{client: client, prefix: prefix}
+}
+
+func (s *RedisLimiterStore) Take(ctx context.Context, key string, limit int, window time.Duration) (RateLimitDecision, error) {
+	result, err := takeScript.Run(ctx, s.client, []string{s.prefix + key}, limit, window.Milliseconds()).Slice()
+	if err != nil {
+		return RateLimitDecision{}, fmt.Errorf("failed to take rate limit token: %w", err)
+	}
+	if len(result) != 2 {
+		return RateLimitDecision{}, fmt.Errorf("unexpected rate limit reply: %v", result)
+	}
+
+	allowed, _ := result[0].(int64)
+	raw, _ := result[1].(string)
+	tokens, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return RateLimitDecision{}, fmt.Errorf("unexpected rate limit reply: %v", result)
+	}
+
+	return newDecision(allowed == 1, tokens, limit, window), nil
+}
@@ -0,0 +1,185 @@
+package middlewares
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// newTestRedisStore returns a store backed by miniredis. The server clock is
+// frozen at start, so refills only happen when the test moves it.
+func newTestRedisStore(t *testing.T) (*RedisLimiterStore, *miniredis.Miniredis, time.Time) {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	server.SetTime(start)
+
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	return NewRedisLimiterStore(client, "tunnerse:ratelimit:"), server, start
+}
+
+func take(t *testing.T, store LimiterStore, key string, limit int, window time.Duration) RateLimitDecision {
+	t.Helper()
+	d, err := store.Take(context.Background(), key, limit, window)
+	if err != nil {
+		t.Fatalf("Take(%q) failed: %v", key, err)
+	}
+	return d
+}
+
+func TestRedisLimiterStoreBurst(t *testing.T) {
+	store, _, _ := newTestRedisStore(t)
+
+	for i := 1; i <= 3; i++ {
+		d := take(t, store, "ip:1", 3, time.Minute)
+		if !d.Allowed || d.Remaining != 3-i || d.Limit != 3 {
+			t.Fatalf("take %d = %+v, want allowed with %d remaining", i, d, 3-i)
+		}
+	}
+
+	d := take(t, store, "ip:1", 3, time.Minute)
+	if d.Allowed || d.Remaining != 0 {
+		t.Fatalf("take over burst = %+v, want denied", d)
+	}
+	if d.Retry != 20*time.Second {
+		t.Errorf("Retry = %s, want 20s", d.Retry)
+	}
+	if d.Reset != time.Minute {
+		t.Errorf("Reset = %s, want 1m", d.Reset)
+	}
+}
+
+func TestRedisLimiterStoreRefill(t *testing.T) {
+	store, server, start := newTestRedisStore(t)
+
+	for i := 0; i < 3; i++ {
+		take(t, store, "ip:1", 3, time.Minute)
+	}
+	if d := take(t, store, "ip:1", 3, time.Minute); d.Allowed {
+		t.Fatalf("take over burst = %+v, want denied", d)
+	}
+
+	// Um terço da janela devolve um token
+	server.SetTime(start.Add(20 * time.Second))
+	if d := take(t, store, "ip:1", 3, time.Minute); !d.Allowed || d.Remaining != 0 {
+		t.Fatalf("take after 20s = %+v, want one token back", d)
+	}
+	if d := take(t, store, "ip:1", 3, time.Minute); d.Allowed {
+		t.Fatalf("second take after 20s = %+v, want denied", d)
+	}
+
+	// Depois da janela inteira o balde está cheio, sem passar do limite
+	server.SetTime(start.Add(20*time.Second + 5*time.Minute))
+	if d := take(t, store, "ip:1", 3, time.Minute); !d.Allowed || d.Remaining != 2 {
+		t.Fatalf("take after the window = %+v, want a full bucket", d)
+	}
+}
+
+func TestRedisLimiterStoreExpires(t *testing.T) {
+	store, server, _ := newTestRedisStore(t)
+
+	take(t, store, "ip:1", 3, time.Minute)
+	if ttl := server.TTL("tunnerse:ratelimit:ip:1"); ttl != 2*time.Minute {
+		t.Fatalf("TTL = %s, want 2m", ttl)
+	}
+
+	server.FastForward(2 * time.Minute)
+	if server.Exists("tunnerse:ratelimit:ip:1") {
+		t.Fatal("idle bucket was not expired")
+	}
+}
+
+func TestRedisLimiterStoreSeparateKeys(t *testing.T) {
+	store, _, _ := newTestRedisStore(t)
+
+	take(t, store, "ip:1", 1, time.Minute)
+	if d := take(t, store, "ip:1", 1, time.Minute); d.Allowed {
+		t.Fatalf("ip:1 = %+v, want denied", d)
+	}
+	for _, key := range []string{"ip:2", "tunnel:1"} {
+		if d := take(t, store, key, 1, time.Minute); !d.Allowed {
+			t.Errorf("%s = %+v, want its own bucket", key, d)
+		}
+	}
+}
+
+func TestRedisLimiterStoreSharedBetweenNodes(t *testing.T) {
+	store, server, _ := newTestRedisStore(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+	other := NewRedisLimiterStore(client, "tunnerse:ratelimit:")
+
+	take(t, store, "ip:1", 2, time.Minute)
+	take(t, other, "ip:1", 2, time.Minute)
+	if d := take(t, store, "ip:1", 2, time.Minute); d.Allowed {
+		t.Fatalf("third take across nodes = %+v, want denied", d)
+	}
+}
+
+func TestRedisLimiterStoreError(t *testing.T) {
+	store, server, _ := newTestRedisStore(t)
+	server.Close()
+
+	if _, err := store.Take(context.Background(), "ip:1", 1, time.Minute); err == nil {
+		t.Fatal("Take() on a closed server succeeded")
+	}
+}
+
+func TestLimiterStoreParity(t *testing.T) {
+	redisStore, _, _ := newTestRedisStore(t)
+	memoryStore := NewMemoryLimiterStore()
+
+	steps := []struct {
+		key   string
+		limit int
+	}{
+		{"ip:1", 2}, {"ip:1", 2}, {"ip:1", 2},
+		{"ip:2", 2},
+		{"tunnel:a", 1}, {"tunnel:a", 1},
+		{"ip:2", 2}, {"ip:2", 2},
+	}
+
+	for i, step := range steps {
+		want := take(t, memoryStore, step.key, step.limit, time.Hour)
+		got := take(t, redisStore, step.key, step.limit, time.Hour)
+
+		// O relógio da memória anda durante o teste; só o inteiro precisa bater
+		if got.Allowed != want.Allowed || got.Remaining != want.Remaining || got.Limit != want.Limit {
+			t.Errorf("step %d (%s): redis %+v, memory %+v", i, step.key, got, want)
+		}
+		if diff := got.Reset - want.Reset; diff < -time.Second || diff > time.Second {
+			t.Errorf("step %d (%s): Reset redis %s, memory %s", i, step.key, got.Reset, want.Reset)
+		}
+		if diff := got.Retry - want.Retry; diff < -time.Second || diff > time.Second {
+			t.Errorf("step %d (%s): Retry redis %s, memory %s", i, step.key, got.Retry, want.Retry)
+		}
+	}
+}
+
+func TestLimiterStoreRefillParity(t *testing.T) {
+	redisStore, server, start := newTestRedisStore(t)
+	memoryStore := NewMemoryLimiterStore()
+	window := 200 * time.Millisecond
+
+	both := func(step string, allowed bool) {
+		t.Helper()
+		for name, store := range map[string]LimiterStore{"redis": redisStore, "memory": memoryStore} {
+			if d := take(t, store, "ip:1", 1, window); d.Allowed != allowed {
+				t.Errorf("%s: %s allowed = %v, want %v", step, name, d.Allowed, allowed)
+			}
+		}
+	}
+
+	both("first take", true)
+	both("empty bucket", false)
+
+	time.Sleep(window + 50*time.Millisecond)
+	server.SetTime(start.Add(window + 50*time.Millisecond))
+	both("after the window", true)
+}
@@ -0,0 +1,17 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// APIKey identifies an account allowed to register tunnels and the limits
+// applied to it.
+type APIKey struct {
+	ID              primitive.ObjectID `bson:"_id,omitempty" json:"-"`
+	Name            string             `bson:"name" json:"name"`
+	Key             string             `bson:"-" json:"key,omitempty"`                   // Texto puro, aceito apenas no arquivo
+	KeyHash         string             `bson:"key_hash" json:"key_hash,omitempty"`       // SHA-256 em hex
+	MaxTunnels      int                `bson:"max_tunnels" json:"max_tunnels"`           // 0 = sem limite
+	AllowedPrefixes []string           `bson:"allowed_prefixes" json:"allowed_prefixes"` // Vazio = qualquer nome
+	MaxLifetime     int                `bson:"max_lifetime" json:"max_lifetime"`         // Em segundos, substitui TUNNEL_LIFE_TIME
+	ReservedNames   []string           `bson:"reserved_names" json:"reserved_names"`     // Nomes que só esta chave pode registrar
+	Disabled        bool               `bson:"disabled" json:"disabled"`
+}
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"net/http"
+	"time"
+)
+
+// RequestRecord is one exchange relayed through a tunnel, kept so it can be
+// inspected and replayed. Bodies are cut at HISTORY_BODY_LIMIT.
+type RequestRecord struct {
+	ID        string    `json:"id" bson:"id"`
+	Tunnel    string    `json:"tunnel" bson:"tunnel"`
+	Token     string    `json:"token" bson:"token"` // Tunnerse-Request-Token
+	StartedAt time.Time `json:"started_at" bson:"started_at"`
+
+	Method        string      `json:"method" bson:"method"`
+	Path          string      `json:"path" bson:"path"`
+	Host          string      `json:"host" bson:"host"`
+	ClientIP      string      `json:"client_ip" bson:"client_ip"`
+	Header        http.Header `json:"headers" bson:"headers"`
+	Body          []byte      `json:"body" bson:"body"`
+	BodySize      int64       `json:"body_size" bson:"body_size"`
+	BodyTruncated bool        `json:"body_truncated,omitempty" bson:"body_truncated,omitempty"`
+
+	Status                int         `json:"status" bson:"status"`
+	ResponseHeader        http.Header `json:"response_headers" bson:"response_headers"`
+	ResponseBody          []byte      `json:"response_body" bson:"response_body"`
+	ResponseBodySize      int64       `json:"response_body_size" bson:"response_body_size"`
+	ResponseBodyTruncated bool        `json:"response_body_truncated,omitempty" bson:"response_body_truncated,omitempty"`
+
+	QueueTime time.Duration `json:"queue_time" bson:"queue_time"` // Espera até o agente retirar a requisição
+	WaitTime  time.Duration `json:"wait_time" bson:"wait_time"`   // Espera pela resposta do agente
+	Latency   time.Duration `json:"latency" bson:"latency"`
+	Error     string        `json:"error,omitempty" bson:"error,omitempty"`
+	Replay    bool          `json:"replay,omitempty" bson:"replay,omitempty"`
+	TraceID   string        `json:"trace_id,omitempty" bson:"trace_id,omitempty"`
+}
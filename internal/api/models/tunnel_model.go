@@ -7,10 +7,41 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+const (
+	TunnelTypeHTTP = "http"
+	TunnelTypeTCP  = "tcp"
+	TunnelTypeUDP  = "udp"
+)
+
 type Tunnel struct {
 	ID        primitive.ObjectID `bson:"_id,omitempty"`
 	Name      string             `bson:"name"`
 	CreatedAt time.Time          `bson:"created_at"`
+	Options   TunnelOptions      `bson:"options"`
+	Port      int                `bson:"port,omitempty"`       // Porta pública dos túneis tcp e udp
+	Owner     string             `bson:"owner,omitempty"`      // Api key que registrou o túnel
+	ExpiresAt *time.Time         `bson:"expires_at,omitempty"` // Índice TTL remove o registro
+
+	SecretHash []byte `bson:"secret_hash"` // SHA-256 do segredo entregue ao agente
+	Secret     string `bson:"-"`           // Só existe na resposta do registro
+}
+
+// TunnelOptions are the per-tunnel settings chosen by the agent on register.
+type TunnelOptions struct {
+	Type   string      `json:"type" bson:"type"`        // http (default), tcp or udp
+	Stream bool        `json:"stream" bson:"stream"`    // Bodies flow through /_tunnerse/stream instead of JSON
+	Auth   *TunnelAuth `json:"-" bson:"auth,omitempty"` // Credentials required on the public URL
+
+	Allow []string `json:"allow,omitempty" bson:"allow,omitempty"` // CIDRs allowed to reach the tunnel
+	Deny  []string `json:"deny,omitempty" bson:"deny,omitempty"`   // CIDRs always rejected
+}
+
+// TunnelAuth protects the public URL of a tunnel with Basic auth, a shared
+// token or both. Only hashes are kept.
+type TunnelAuth struct {
+	Username     string `bson:"username,omitempty"`
+	PasswordHash []byte `bson:"password_hash,omitempty"`
+	TokenHash    []byte `bson:"token_hash,omitempty"`
 }
 
 type SerializableRequest struct {
@@ -20,7 +51,11 @@ type SerializableRequest struct {
 	Body      string      `json:"body"`
 	Host      string      `json:"host"`
 	RequestID string      `json:"request_id"`
-	Token     string      `json:"token"` // Tunnerse-Request-Token
+	Token     string      `json:"token"`             // Tunnerse-Request-Token
+	Remote    string      `json:"remote,omitempty"`  // Endereço do cliente público (ip:porta)
+	Upgrade   bool        `json:"upgrade,omitempty"` // Agent must open a stream with the token
+	Stream    bool        `json:"stream,omitempty"`  // Agent must open a stream and relay raw HTTP
+	TCP       bool        `json:"tcp,omitempty"`     // Agent must open a stream and pipe raw bytes
 }
 
 type ResponseData struct {
@@ -29,3 +64,42 @@ type ResponseData struct {
 	Body       string              `json:"body"`
 	Token      string              `json:"token"` // Tunnerse-Request-Token
 }
+
+const (
+	FrameRequest      = "request"
+	FrameResponse     = "response"
+	FrameDatagram     = "datagram"
+	FrameSessionClose = "session_close"
+)
+
+// Frame is the envelope exchanged over a persistent agent connection. Each
+// frame is one JSON text message, multiplexed by Tunnerse-Request-Token.
+type Frame struct {
+	Type     string               `json:"type"`
+	Request  *SerializableRequest `json:"request,omitempty"`
+	Response *ResponseData        `json:"response,omitempty"`
+	Datagram *Datagram            `json:"datagram,omitempty"`
+}
+
+// Datagram is a UDP payload exchanged with the agent for one remote peer.
+type Datagram struct {
+	Session string `json:"session"`
+	Remote  string `json:"remote,omitempty"`
+	Data    []byte `json:"data,omitempty"` // base64 no JSON
+}
+
+type UDPStats struct {
+	Sessions   int    `json:"sessions"`
+	PacketsIn  uint64 `json:"packets_in"`
+	BytesIn    uint64 `json:"bytes_in"`
+	PacketsOut uint64 `json:"packets_out"`
+	BytesOut   uint64 `json:"bytes_out"`
+	Dropped    uint64 `json:"dropped"`
+}
+
+type TunnelStats struct {
+	Name string    `json:"name"`
+	Type string    `json:"type"`
+	Port int       `json:"port,omitempty"`
+	UDP  *UDPStats `json:"udp,omitempty"`
+}
@@ -0,0 +1,198 @@
+package repositories
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+
+	bolt "go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/models"
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/utils"
+)
+
+var (
+	apiKeysBucket       = []byte("api_keys")
+	reservedNamesBucket = []byte("reserved_names") // Nome -> key_hash
+)
+
+// BoltAPIKeyRepository keeps keys in the embedded database, indexed by the
+// hash of the key, along with the names each key reserved.
+type BoltAPIKeyRepository struct {
+	db *bolt.DB
+}
+
+func NewBoltAPIKeyRepository(db *bolt.DB) (*BoltAPIKeyRepository, error) {
+	err := db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(apiKeysBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(reservedNamesBucket)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &BoltAPIKeyRepository{db: db}, nil
+}
+
+// Import makes the stored keys mirror a JSON key file, in the same format
+// read by FileAPIKeyRepository: every key of the file is saved and keys
+// missing from it are deleted along with their reserved names, all in one
+// transaction. It returns how many keys were imported and removed.
+func (r *BoltAPIKeyRepository) Import(ctx context.Context, path string) (int, int, error) {
+	keys, err := readAPIKeyFile(path)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	listed := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		listed[key.KeyHash] = true
+	}
+
+	removed := 0
+	err = r.db.Update(func(tx *bolt.Tx) error {
+		var stale []string
+		err := tx.Bucket(apiKeysBucket).ForEach(func(hash, _ []byte) error {
+			if !listed[string(hash)] {
+				stale = append(stale, string(hash))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, hash := range stale {
+			if err := deleteAPIKey(tx, hash); err != nil {
+				return err
+			}
+		}
+		removed = len(stale)
+
+		// Libera todos os nomes antes de salvar, para que um nome reservado
+		// possa trocar de chave no arquivo
+		for _, key := range keys {
+			if err := releaseNames(tx, key.KeyHash); err != nil {
+				return err
+			}
+		}
+		for _, key := range keys {
+			if err := saveAPIKey(tx, key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	return len(keys), removed, nil
+}
+
+func (r *BoltAPIKeyRepository) Save(ctx context.Context, key *models.APIKey) error {
+	if key.KeyHash == "" && key.Key != "" {
+		key.KeyHash = hex.EncodeToString(utils.HashSecret(key.Key))
+	}
+	if key.KeyHash == "" {
+		return fmt.Errorf("api key has no key")
+	}
+
+	return r.db.Update(func(tx *bolt.Tx) error {
+		return saveAPIKey(tx, key)
+	})
+}
+
+func saveAPIKey(tx *bolt.Tx, key *models.APIKey) error {
+	data, err := bson.Marshal(key)
+	if err != nil {
+		return err
+	}
+
+	// Libera os nomes que a versão anterior da chave reservava
+	if err := releaseNames(tx, key.KeyHash); err != nil {
+		return err
+	}
+
+	reserved := tx.Bucket(reservedNamesBucket)
+	for _, name := range key.ReservedNames {
+		if owner := reserved.Get([]byte(name)); owner != nil && string(owner) != key.KeyHash {
+			return fmt.Errorf("tunnel name %q is already reserved", name)
+		}
+		if err := reserved.Put([]byte(name), []byte(key.KeyHash)); err != nil {
+			return err
+		}
+	}
+
+	return tx.Bucket(apiKeysBucket).Put([]byte(key.KeyHash), data)
+}
+
+func deleteAPIKey(tx *bolt.Tx, hash string) error {
+	if err := releaseNames(tx, hash); err != nil {
+		return err
+	}
+	return tx.Bucket(apiKeysBucket).Delete([]byte(hash))
+}
+
+// releaseNames frees the names reserved by the stored version of the key.
+func releaseNames(tx *bolt.Tx, hash string) error {
+	previous := tx.Bucket(apiKeysBucket).Get([]byte(hash))
+	if previous == nil {
+		return nil
+	}
+
+	var old models.APIKey
+	if err := bson.Unmarshal(previous, &old); err != nil {
+		return err
+	}
+	reserved := tx.Bucket(reservedNamesBucket)
+	for _, name := range old.ReservedNames {
+		if string(reserved.Get([]byte(name))) == hash {
+			if err := reserved.Delete([]byte(name)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (r *BoltAPIKeyRepository) find(tx *bolt.Tx, hash []byte) (*models.APIKey, error) {
+	data := tx.Bucket(apiKeysBucket).Get(hash)
+	if data == nil {
+		return nil, ErrAPIKeyNotFound
+	}
+
+	var found models.APIKey
+	if err := bson.Unmarshal(data, &found); err != nil {
+		return nil, err
+	}
+	return &found, nil
+}
+
+func (r *BoltAPIKeyRepository) FindByKey(ctx context.Context, key string) (*models.APIKey, error) {
+	hash := []byte(hex.EncodeToString(utils.HashSecret(key)))
+
+	var found *models.APIKey
+	err := r.db.View(func(tx *bolt.Tx) error {
+		var err error
+		found, err = r.find(tx, hash)
+		return err
+	})
+	return found, err
+}
+
+func (r *BoltAPIKeyRepository) FindByReservedName(ctx context.Context, name string) (*models.APIKey, error) {
+	var found *models.APIKey
+	err := r.db.View(func(tx *bolt.Tx) error {
+		hash := tx.Bucket(reservedNamesBucket).Get([]byte(name))
+		if hash == nil {
+			return ErrAPIKeyNotFound
+		}
+		var err error
+		found, err = r.find(tx, hash)
+		return err
+	})
+	return found, err
+}
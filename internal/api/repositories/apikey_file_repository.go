@@ -0,0 +1,112 @@
+package repositories
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/models"
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/utils"
+)
+
+// FileAPIKeyRepository reads keys from a JSON array on disk. The file is
+// read again whenever it changes, so keys can be edited without a restart.
+type FileAPIKeyRepository struct {
+	path    string
+	keys    []*models.APIKey
+	modTime time.Time
+	mu      sync.Mutex
+}
+
+func NewFileAPIKeyRepository(path string) (*FileAPIKeyRepository, error) {
+	r := &FileAPIKeyRepository{path: path}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// readAPIKeyFile parses a JSON array of keys, hashing the ones given in
+// plain text.
+func readAPIKeyFile(path string) ([]*models.APIKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []*models.APIKey
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("invalid api key file: %w", err)
+	}
+	for i, key := range keys {
+		if key.KeyHash == "" && key.Key != "" {
+			key.KeyHash = hex.EncodeToString(utils.HashSecret(key.Key))
+		}
+		key.Key = ""
+		if key.KeyHash == "" {
+			return nil, fmt.Errorf("invalid api key file: entry %d has no key", i)
+		}
+	}
+	return keys, nil
+}
+
+func (r *FileAPIKeyRepository) reload() error {
+	info, err := os.Stat(r.path)
+	if err != nil {
+		return err
+	}
+	if info.ModTime().Equal(r.modTime) {
+		return nil
+	}
+
+	keys, err := readAPIKeyFile(r.path)
+	if err != nil {
+		return err
+	}
+
+	r.keys = keys
+	r.modTime = info.ModTime()
+	return nil
+}
+
+func (r *FileAPIKeyRepository) FindByKey(ctx context.Context, key string) (*models.APIKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+
+	hash := []byte(hex.EncodeToString(utils.HashSecret(key)))
+	for _, candidate := range r.keys {
+		if subtle.ConstantTimeCompare(hash, []byte(candidate.KeyHash)) == 1 {
+			found := *candidate
+			return &found, nil
+		}
+	}
+	return nil, ErrAPIKeyNotFound
+}
+
+func (r *FileAPIKeyRepository) FindByReservedName(ctx context.Context, name string) (*models.APIKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+
+	for _, candidate := range r.keys {
+		for _, reserved := range candidate.ReservedNames {
+			if reserved == name {
+				found := *candidate
+				return &found, nil
+			}
+		}
+	}
+	return nil, ErrAPIKeyNotFound
+}
@@ -0,0 +1,63 @@
+package repositories
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/models"
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/utils"
+)
+
+type MongoAPIKeyRepository struct {
+	collection *mongo.Collection
+}
+
+func NewMongoAPIKeyRepository(ctx context.Context, db *mongo.Database) (*MongoAPIKeyRepository, error) {
+	collection := db.Collection("api_keys")
+
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "key_hash", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "reserved_names", Value: 1}},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &MongoAPIKeyRepository{collection: collection}, nil
+}
+
+func (r *MongoAPIKeyRepository) FindByKey(ctx context.Context, key string) (*models.APIKey, error) {
+	hash := hex.EncodeToString(utils.HashSecret(key))
+
+	var found models.APIKey
+	err := r.collection.FindOne(ctx, bson.M{"key_hash": hash}).Decode(&found)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &found, nil
+}
+
+func (r *MongoAPIKeyRepository) FindByReservedName(ctx context.Context, name string) (*models.APIKey, error) {
+	var found models.APIKey
+	err := r.collection.FindOne(ctx, bson.M{"reserved_names": name}).Decode(&found)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &found, nil
+}
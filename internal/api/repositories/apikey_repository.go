@@ -0,0 +1,19 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/models"
+)
+
+var (
+	ErrAPIKeyNotFound = errors.New("api key not found")
+)
+
+// APIKeyRepository looks up the accounts allowed to register tunnels.
+type APIKeyRepository interface {
+	FindByKey(ctx context.Context, key string) (*models.APIKey, error)
+	// FindByReservedName returns the key that reserved a tunnel name.
+	FindByReservedName(ctx context.Context, name string) (*models.APIKey, error)
+}
@@ -0,0 +1,169 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/models"
+)
+
+func openTestBolt(t *testing.T) *bolt.DB {
+	t.Helper()
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "tunnerse.db"), 0o600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestBoltHistoryAppendKeepsNewest(t *testing.T) {
+	repo, err := NewBoltHistoryRepository(openTestBolt(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	for i := 0; i < 10; i++ {
+		if err := repo.Append(ctx, &models.RequestRecord{ID: fmt.Sprint(i), Tunnel: "demo"}, 3); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := repo.Append(ctx, &models.RequestRecord{ID: "other", Tunnel: "other"}, 3); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := repo.List(ctx, "demo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, record := range records {
+		ids = append(ids, record.ID)
+	}
+	if fmt.Sprint(ids) != "[7 8 9]" {
+		t.Errorf("demo history = %v, want [7 8 9]", ids)
+	}
+
+	// Um limite menor depois de um reinício apara o excedente de uma vez
+	if err := repo.Append(ctx, &models.RequestRecord{ID: "10", Tunnel: "demo"}, 1); err != nil {
+		t.Fatal(err)
+	}
+	if records, _ = repo.List(ctx, "demo"); len(records) != 1 || records[0].ID != "10" {
+		t.Errorf("history after shrinking = %d records, want only 10", len(records))
+	}
+
+	if records, _ = repo.List(ctx, "other"); len(records) != 1 {
+		t.Errorf("other history = %d records, want 1", len(records))
+	}
+}
+
+func TestBoltHistoryAppendConcurrent(t *testing.T) {
+	repo, err := NewBoltHistoryRepository(openTestBolt(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := repo.Append(ctx, &models.RequestRecord{ID: fmt.Sprint(i), Tunnel: "demo"}, 20); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	records, err := repo.List(ctx, "demo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 20 {
+		t.Errorf("history = %d records, want 20", len(records))
+	}
+}
+
+func writeKeyFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBoltAPIKeyImportMirrorsFile(t *testing.T) {
+	repo, err := NewBoltAPIKeyRepository(openTestBolt(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "api_keys.json")
+
+	writeKeyFile(t, path, `[
+		{"name": "alice", "key": "key-alice", "reserved_names": ["shop"]},
+		{"name": "bob", "key": "key-bob", "reserved_names": ["blog"]}
+	]`)
+	if imported, removed, err := repo.Import(ctx, path); err != nil || imported != 2 || removed != 0 {
+		t.Fatalf("first Import() = %d, %d, %v; want 2, 0, nil", imported, removed, err)
+	}
+
+	// bob sai do arquivo e alice passa o nome "shop" para carol
+	writeKeyFile(t, path, `[
+		{"name": "alice", "key": "key-alice"},
+		{"name": "carol", "key": "key-carol", "reserved_names": ["shop"]}
+	]`)
+	if imported, removed, err := repo.Import(ctx, path); err != nil || imported != 2 || removed != 1 {
+		t.Fatalf("second Import() = %d, %d, %v; want 2, 1, nil", imported, removed, err)
+	}
+
+	if _, err := repo.FindByKey(ctx, "key-bob"); !errors.Is(err, ErrAPIKeyNotFound) {
+		t.Errorf("removed key still found: %v", err)
+	}
+	if _, err := repo.FindByReservedName(ctx, "blog"); !errors.Is(err, ErrAPIKeyNotFound) {
+		t.Errorf("name of a removed key still reserved: %v", err)
+	}
+	if key, err := repo.FindByReservedName(ctx, "shop"); err != nil || key.Name != "carol" {
+		t.Errorf("shop reserved by %v (%v), want carol", key, err)
+	}
+	if _, err := repo.FindByKey(ctx, "key-alice"); err != nil {
+		t.Errorf("kept key not found: %v", err)
+	}
+}
+
+func TestBoltAPIKeyImportRollsBack(t *testing.T) {
+	repo, err := NewBoltAPIKeyRepository(openTestBolt(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "api_keys.json")
+
+	writeKeyFile(t, path, `[{"name": "alice", "key": "key-alice"}]`)
+	if _, _, err := repo.Import(ctx, path); err != nil {
+		t.Fatal(err)
+	}
+
+	// Dois donos para o mesmo nome: nada do arquivo novo é aplicado
+	writeKeyFile(t, path, `[
+		{"name": "bob", "key": "key-bob", "reserved_names": ["shop"]},
+		{"name": "carol", "key": "key-carol", "reserved_names": ["shop"]}
+	]`)
+	if _, _, err := repo.Import(ctx, path); err == nil {
+		t.Fatal("Import() with a name reserved twice succeeded")
+	}
+	if _, err := repo.FindByKey(ctx, "key-alice"); err != nil {
+		t.Errorf("failed import removed a key: %v", err)
+	}
+	if _, err := repo.FindByKey(ctx, "key-bob"); !errors.Is(err, ErrAPIKeyNotFound) {
+		t.Errorf("failed import saved a key: %v", err)
+	}
+}
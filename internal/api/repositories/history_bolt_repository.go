@@ -0,0 +1,105 @@
+package repositories
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+
+	bolt "go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/models"
+)
+
+var historyBucket = []byte("history")
+
+// BoltHistoryRepository keeps one nested bucket per tunnel, with records
+// keyed by a sequence so cursor order is insertion order.
+type BoltHistoryRepository struct {
+	db *bolt.DB
+}
+
+func NewBoltHistoryRepository(db *bolt.DB) (*BoltHistoryRepository, error) {
+	err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(historyBucket)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &BoltHistoryRepository{db: db}, nil
+}
+
+// Append stores record and drops the oldest ones beyond keep. Concurrent
+// calls are coalesced by db.Batch into a single commit, so busy tunnels do not
+// pay one fsync per request.
+func (r *BoltHistoryRepository) Append(ctx context.Context, record *models.RequestRecord, keep int) error {
+	data, err := bson.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	return r.db.Batch(func(tx *bolt.Tx) error {
+		bucket, err := tx.Bucket(historyBucket).CreateBucketIfNotExists([]byte(record.Tunnel))
+		if err != nil {
+			return err
+		}
+
+		seq, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		if err := bucket.Put(historyKey(seq), data); err != nil {
+			return err
+		}
+
+		// Só se apaga a partir do início, então as chaves são contíguas e
+		// seq - primeira + 1 é o total sem percorrer o bucket
+		cursor := bucket.Cursor()
+		for k, _ := cursor.First(); k != nil && seq-binary.BigEndian.Uint64(k) >= uint64(keep); k, _ = cursor.First() {
+			if err := cursor.Delete(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func historyKey(seq uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, seq)
+	return key
+}
+
+func (r *BoltHistoryRepository) List(ctx context.Context, tunnel string) ([]*models.RequestRecord, error) {
+	var records []*models.RequestRecord
+
+	err := r.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(historyBucket).Bucket([]byte(tunnel))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(_, data []byte) error {
+			var record models.RequestRecord
+			if err := bson.Unmarshal(data, &record); err != nil {
+				return err
+			}
+			records = append(records, &record)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+func (r *BoltHistoryRepository) DeleteTunnel(ctx context.Context, tunnel string) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		err := tx.Bucket(historyBucket).DeleteBucket([]byte(tunnel))
+		if errors.Is(err, bolt.ErrBucketNotFound) {
+			return nil
+		}
+		return err
+	})
+}
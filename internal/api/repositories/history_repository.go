@@ -0,0 +1,17 @@
+package repositories
+
+import (
+	"context"
+
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/models"
+)
+
+// HistoryRepository keeps the recent exchanges of every tunnel.
+type HistoryRepository interface {
+	// Append stores the record and drops the oldest ones of its tunnel so
+	// that at most keep remain.
+	Append(ctx context.Context, record *models.RequestRecord, keep int) error
+	// List returns the records of a tunnel, oldest first.
+	List(ctx context.Context, tunnel string) ([]*models.RequestRecord, error)
+	DeleteTunnel(ctx context.Context, tunnel string) error
+}
@@ -0,0 +1,88 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/models"
+)
+
+var tunnelsBucket = []byte("tunnels")
+
+// BoltTunnelRepository keeps tunnel records in the embedded database, one
+// BSON document per tunnel name.
+type BoltTunnelRepository struct {
+	db *bolt.DB
+}
+
+func NewBoltTunnelRepository(db *bolt.DB) (*BoltTunnelRepository, error) {
+	err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(tunnelsBucket)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &BoltTunnelRepository{db: db}, nil
+}
+
+func (r *BoltTunnelRepository) Save(ctx context.Context, tunnel *models.Tunnel) error {
+	data, err := bson.Marshal(tunnel)
+	if err != nil {
+		return err
+	}
+	return r.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(tunnelsBucket).Put([]byte(tunnel.Name), data)
+	})
+}
+
+func (r *BoltTunnelRepository) Delete(ctx context.Context, name string) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(tunnelsBucket)
+		if bucket.Get([]byte(name)) == nil {
+			return ErrTunnelNotFound
+		}
+		return bucket.Delete([]byte(name))
+	})
+}
+
+// FindAll also purges expired records, since bolt has no TTL of its own.
+func (r *BoltTunnelRepository) FindAll(ctx context.Context) ([]*models.Tunnel, error) {
+	var tunnels []*models.Tunnel
+
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(tunnelsBucket)
+		now := time.Now()
+
+		var expired [][]byte
+		err := bucket.ForEach(func(name, data []byte) error {
+			var tunnel models.Tunnel
+			if err := bson.Unmarshal(data, &tunnel); err != nil {
+				return err
+			}
+			if tunnel.ExpiresAt != nil && now.After(*tunnel.ExpiresAt) {
+				expired = append(expired, name)
+				return nil
+			}
+			tunnels = append(tunnels, &tunnel)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, name := range expired {
+			if err := bucket.Delete(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tunnels, nil
+}
@@ -0,0 +1,57 @@
+package repositories
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/models"
+)
+
+// MemoryTunnelRepository keeps tunnel records in process. Nothing survives a
+// restart, which matches the behaviour of a server without a database.
+type MemoryTunnelRepository struct {
+	tunnels map[string]models.Tunnel
+	mu      sync.RWMutex
+}
+
+func NewMemoryTunnelRepository() *MemoryTunnelRepository {
+	return &MemoryTunnelRepository{tunnels: make(map[string]models.Tunnel)}
+}
+
+func (r *MemoryTunnelRepository) Save(ctx context.Context, tunnel *models.Tunnel) error {
+	record := *tunnel
+	record.Secret = ""
+
+	r.mu.Lock()
+	r.tunnels[tunnel.Name] = record
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *MemoryTunnelRepository) Delete(ctx context.Context, name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.tunnels[name]; !exists {
+		return ErrTunnelNotFound
+	}
+	delete(r.tunnels, name)
+	return nil
+}
+
+func (r *MemoryTunnelRepository) FindAll(ctx context.Context) ([]*models.Tunnel, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	now := time.Now()
+	tunnels := make([]*models.Tunnel, 0, len(r.tunnels))
+	for _, record := range r.tunnels {
+		if record.ExpiresAt != nil && now.After(*record.ExpiresAt) {
+			continue
+		}
+		record := record
+		tunnels = append(tunnels, &record)
+	}
+	return tunnels, nil
+}
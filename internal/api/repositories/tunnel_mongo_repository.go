@@ -0,0 +1,72 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/models"
+)
+
+type MongoTunnelRepository struct {
+	collection *mongo.Collection
+}
+
+func NewMongoTunnelRepository(ctx context.Context, db *mongo.Database) (*MongoTunnelRepository, error) {
+	collection := db.Collection("tunnels")
+
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "name", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			// O MongoDB apaga o registro assim que expires_at passa
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &MongoTunnelRepository{collection: collection}, nil
+}
+
+func (r *MongoTunnelRepository) Save(ctx context.Context, tunnel *models.Tunnel) error {
+	_, err := r.collection.ReplaceOne(ctx, bson.M{"name": tunnel.Name}, tunnel, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (r *MongoTunnelRepository) Delete(ctx context.Context, name string) error {
+	result, err := r.collection.DeleteOne(ctx, bson.M{"name": name})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrTunnelNotFound
+	}
+	return nil
+}
+
+func (r *MongoTunnelRepository) FindAll(ctx context.Context) ([]*models.Tunnel, error) {
+	// O monitor do TTL roda a cada minuto, então o filtro ainda é necessário
+	filter := bson.M{"$or": bson.A{
+		bson.M{"expires_at": bson.M{"$exists": false}},
+		bson.M{"expires_at": bson.M{"$gt": time.Now()}},
+	}}
+
+	cursor, err := r.collection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	var tunnels []*models.Tunnel
+	if err := cursor.All(ctx, &tunnels); err != nil {
+		return nil, err
+	}
+	return tunnels, nil
+}
@@ -0,0 +1,22 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/models"
+)
+
+var (
+	ErrTunnelNotFound = errors.New("tunnel not found")
+)
+
+// TunnelRepository keeps the metadata of registered tunnels so they can be
+// restored after a restart.
+type TunnelRepository interface {
+	// Save inserts the tunnel or replaces the record with the same name.
+	Save(ctx context.Context, tunnel *models.Tunnel) error
+	Delete(ctx context.Context, name string) error
+	// FindAll returns every tunnel that has not expired yet.
+	FindAll(ctx context.Context) ([]*models.Tunnel, error)
+}
@@ -5,18 +5,33 @@ import (
 
 	"github.com/pedroborgesdev/tunnerse-api/internal/api/config"
 	"github.com/pedroborgesdev/tunnerse-api/internal/api/controllers"
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/logger"
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/middlewares"
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/services"
 
 	"github.com/gin-gonic/gin"
 )
 
-func SetupRoutes(router *gin.Engine) {
+func SetupRoutes(router *gin.Engine, tunnelService *services.TunnelService, limiterStore middlewares.LimiterStore) {
 
-	tunnelController := controllers.NewTunnelController()
+	tunnelController := controllers.NewTunnelController(tunnelService)
+	metricsController := controllers.NewMetricsController()
+
+	publicLimit := middlewares.PublicRateLimiter(limiterStore)
+	registerLimit := middlewares.RegisterRateLimiter(limiterStore)
 
 	router.GET("/health", func(c *gin.Context) {
 		c.String(http.StatusOK, "OK")
 	})
 
+	// Em modo subdomínio, /metrics de um túnel segue para a aplicação dele
+	if config.AppConfig.METRICS_ENABLED {
+		router.GET("/metrics", metricsController.Metrics, publicLimit, tunnelController.Tunnel)
+		if config.AppConfig.METRICS_TOKEN == "" {
+			logger.Log("WARN", "Metrics are served without METRICS_TOKEN and expose tunnel names", []logger.LogDetail{})
+		}
+	}
+
 	// Explicit homepage route (don't rely on NoRoute for "/").
 	// This keeps status codes consistent behind proxies/CDNs.
 
@@ -38,24 +53,49 @@ func SetupRoutes(router *gin.Engine) {
 	tunnel := router.Group("/")
 
 	if config.AppConfig.SUBDOMAIN {
-		tunnel.POST("/register", tunnelController.Register)
+		tunnel.POST("/register", registerLimit, tunnelController.Register)
 		tunnel.GET("/tunnel", tunnelController.Get)
 		tunnel.POST("/response", tunnelController.Response)
 		tunnel.POST("/close", tunnelController.Close)
-		tunnel.GET("/", tunnelController.Tunnel)
-		tunnel.HEAD("/_tunnerse_healthcheck", tunnelController.Tunnel)
 
-		router.NoRoute(tunnelController.Tunnel)
+		// Endpoints de controle ficam sob /_tunnerse para não esconder as rotas da aplicação
+		control := tunnel.Group("/_tunnerse")
+		control.GET("/stream", tunnelController.Stream)
+		control.GET("/connect", tunnelController.Connect)
+		control.GET("/stats", tunnelController.Stats)
+		control.GET("/inspector", tunnelController.Inspector)
+		control.GET("/requests", tunnelController.Requests)
+		control.GET("/requests/stream", tunnelController.Watch)
+		control.GET("/requests/har", tunnelController.ExportHAR)
+		control.POST("/requests/har", tunnelController.ImportHAR)
+		control.POST("/requests/:id/replay", tunnelController.Replay)
+
+		tunnel.GET("/", publicLimit, tunnelController.Tunnel)
+		tunnel.HEAD("/_tunnerse_healthcheck", publicLimit, tunnelController.Tunnel)
+
+		router.NoRoute(publicLimit, tunnelController.Tunnel)
 	}
 
 	if !config.AppConfig.SUBDOMAIN {
-		tunnel.POST("/register", tunnelController.Register)
+		tunnel.POST("/register", registerLimit, tunnelController.Register)
 		tunnel.GET(":name/tunnel", tunnelController.Get)
 		tunnel.POST(":name/response", tunnelController.Response)
 		tunnel.POST(":name/close", tunnelController.Close)
-		tunnel.GET(":name/", tunnelController.Tunnel)
-		tunnel.HEAD(":name/_tunnerse_healthcheck", tunnelController.Tunnel)
 
-		router.NoRoute(tunnelController.Tunnel)
+		control := tunnel.Group(":name/_tunnerse")
+		control.GET("/stream", tunnelController.Stream)
+		control.GET("/connect", tunnelController.Connect)
+		control.GET("/stats", tunnelController.Stats)
+		control.GET("/inspector", tunnelController.Inspector)
+		control.GET("/requests", tunnelController.Requests)
+		control.GET("/requests/stream", tunnelController.Watch)
+		control.GET("/requests/har", tunnelController.ExportHAR)
+		control.POST("/requests/har", tunnelController.ImportHAR)
+		control.POST("/requests/:id/replay", tunnelController.Replay)
+
+		tunnel.GET(":name/", publicLimit, tunnelController.Tunnel)
+		tunnel.HEAD(":name/_tunnerse_healthcheck", publicLimit, tunnelController.Tunnel)
+
+		router.NoRoute(publicLimit, tunnelController.Tunnel)
 	}
 }
@@ -0,0 +1,92 @@
+package services
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/validation"
+)
+
+// accessList holds the networks allowed and denied on a tunnel. Deny entries
+// win over allow entries, and an empty allow list admits everyone else.
+type accessList struct {
+	allow []*net.IPNet
+	deny  []*net.IPNet
+}
+
+func parseNetworks(entries []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(entries))
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+
+		// Um IP sem máscara vale como /32 ou /128
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("%w: %s", validation.ErrInvalidCIDR, entry)
+			}
+			bits := 128
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 32
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", validation.ErrInvalidCIDR, entry)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+func newAccessList(allow, deny []string) (*accessList, error) {
+	if len(allow) == 0 && len(deny) == 0 {
+		return nil, nil
+	}
+
+	allowed, err := parseNetworks(allow)
+	if err != nil {
+		return nil, err
+	}
+	denied, err := parseNetworks(deny)
+	if err != nil {
+		return nil, err
+	}
+	return &accessList{allow: allowed, deny: denied}, nil
+}
+
+func (a *accessList) permits(addr string) bool {
+	if a == nil {
+		return true
+	}
+
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+
+	for _, network := range a.deny {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	if len(a.allow) == 0 {
+		return true
+	}
+	for _, network := range a.allow {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
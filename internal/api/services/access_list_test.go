@@ -0,0 +1,133 @@
+package services
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/validation"
+)
+
+func TestAccessListPermits(t *testing.T) {
+	tests := []struct {
+		name  string
+		allow []string
+		deny  []string
+		addr  string
+		want  bool
+	}{
+		{name: "empty list", addr: "203.0.113.5", want: true},
+		{name: "ipv4 cidr allowed", allow: []string{"203.0.113.0/24"}, addr: "203.0.113.5", want: true},
+		{name: "ipv4 cidr outside", allow: []string{"203.0.113.0/24"}, addr: "198.51.100.1", want: false},
+		{name: "ipv4 with port", allow: []string{"203.0.113.0/24"}, addr: "203.0.113.5:51234", want: true},
+		{name: "single ipv4", allow: []string{"203.0.113.5"}, addr: "203.0.113.5", want: true},
+		{name: "single ipv4 neighbour", allow: []string{"203.0.113.5"}, addr: "203.0.113.6", want: false},
+		{name: "ipv4 mapped ipv6", allow: []string{"203.0.113.0/24"}, addr: "::ffff:203.0.113.5", want: true},
+		{name: "ipv6 cidr allowed", allow: []string{"2001:db8::/32"}, addr: "2001:db8:1::1", want: true},
+		{name: "ipv6 cidr outside", allow: []string{"2001:db8::/32"}, addr: "2001:db9::1", want: false},
+		{name: "ipv6 with port", allow: []string{"2001:db8::/32"}, addr: "[2001:db8::1]:443", want: true},
+		{name: "single ipv6", allow: []string{"2001:db8::1"}, addr: "2001:db8::1", want: true},
+		{name: "single ipv6 neighbour", allow: []string{"2001:db8::1"}, addr: "2001:db8::2", want: false},
+		{name: "ipv4 against ipv6 list", allow: []string{"2001:db8::/32"}, addr: "203.0.113.5", want: false},
+		{name: "deny only", deny: []string{"198.51.100.0/24"}, addr: "198.51.100.7", want: false},
+		{name: "deny only other address", deny: []string{"198.51.100.0/24"}, addr: "203.0.113.5", want: true},
+		{name: "deny wins over allow", allow: []string{"10.0.0.0/8"}, deny: []string{"10.1.0.0/16"}, addr: "10.1.2.3", want: false},
+		{name: "allow around deny", allow: []string{"10.0.0.0/8"}, deny: []string{"10.1.0.0/16"}, addr: "10.2.0.1", want: true},
+		{name: "entries are trimmed", allow: []string{" 203.0.113.0/24 "}, addr: "203.0.113.5", want: true},
+		{name: "unparsable address", allow: []string{"0.0.0.0/0"}, addr: "not-an-ip", want: false},
+		{name: "empty address", deny: []string{"198.51.100.0/24"}, addr: "", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list, err := newAccessList(tt.allow, tt.deny)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := list.permits(tt.addr); got != tt.want {
+				t.Errorf("permits(%q) = %v, want %v", tt.addr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewAccessListInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		allow []string
+		deny  []string
+	}{
+		{name: "garbage", allow: []string{"localhost"}},
+		{name: "empty entry", allow: []string{""}},
+		{name: "bad mask", allow: []string{"10.0.0.0/33"}},
+		{name: "bad ipv6 mask", deny: []string{"2001:db8::/129"}},
+		{name: "bad octet", deny: []string{"10.0.0.256"}},
+		{name: "invalid after valid", allow: []string{"10.0.0.0/8", "10.0.0.0/x"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newAccessList(tt.allow, tt.deny); !errors.Is(err, validation.ErrInvalidCIDR) {
+				t.Errorf("newAccessList() error = %v, want %v", err, validation.ErrInvalidCIDR)
+			}
+		})
+	}
+}
+
+// TestAccessListForwardedFor checks the address tunnels actually receive,
+// ctx.ClientIP(), which only follows X-Forwarded-For from trusted proxies.
+func TestAccessListForwardedFor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	list, err := newAccessList([]string{"203.0.113.0/24"}, []string{"203.0.113.66"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router := gin.New()
+	if err := router.SetTrustedProxies([]string{"10.0.0.1"}); err != nil {
+		t.Fatal(err)
+	}
+	router.GET("/", func(ctx *gin.Context) {
+		if !list.permits(ctx.ClientIP()) {
+			ctx.Status(http.StatusForbidden)
+			return
+		}
+		ctx.Status(http.StatusOK)
+	})
+
+	tests := []struct {
+		name   string
+		remote string
+		xff    string
+		want   int
+	}{
+		{name: "direct allowed", remote: "203.0.113.5:4000", want: http.StatusOK},
+		{name: "direct denied", remote: "198.51.100.1:4000", want: http.StatusForbidden},
+		{name: "trusted proxy forwards allowed client", remote: "10.0.0.1:4000", xff: "203.0.113.5", want: http.StatusOK},
+		{name: "trusted proxy forwards denied client", remote: "10.0.0.1:4000", xff: "203.0.113.66", want: http.StatusForbidden},
+		{name: "trusted proxy forwards outside client", remote: "10.0.0.1:4000", xff: "198.51.100.1", want: http.StatusForbidden},
+		{name: "trusted proxy forwards ipv6 client", remote: "10.0.0.1:4000", xff: "2001:db8::1", want: http.StatusForbidden},
+		{name: "client is the rightmost untrusted hop", remote: "10.0.0.1:4000", xff: "198.51.100.1, 203.0.113.5", want: http.StatusOK},
+		{name: "spoofed leftmost hop is ignored", remote: "10.0.0.1:4000", xff: "203.0.113.5, 198.51.100.1", want: http.StatusForbidden},
+		{name: "untrusted peer cannot spoof", remote: "198.51.100.1:4000", xff: "203.0.113.5", want: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remote
+			if tt.xff != "" {
+				r.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,246 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/models"
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/utils"
+)
+
+// ExportHAR returns the history of a tunnel as a HAR 1.2 log, oldest first.
+func (s *TunnelService) ExportHAR(name string) (*models.HAR, error) {
+	records, err := s.Requests(name)
+	if err != nil {
+		return nil, err
+	}
+
+	har := &models.HAR{Log: models.HARLog{
+		Version: "1.2",
+		Creator: models.HARCreator{Name: "tunnerse", Version: "1.0"},
+		Entries: make([]models.HAREntry, 0, len(records)),
+	}}
+	for _, record := range records {
+		har.Log.Entries = append(har.Log.Entries, harEntry(name, record))
+	}
+	return har, nil
+}
+
+// ImportHAR replays the entries of a HAR log through the tunnel in order and
+// returns the record of every new exchange. It stops at the first entry that
+// cannot be replayed.
+func (s *TunnelService) ImportHAR(ctx context.Context, name string, har *models.HAR, clientIP string) ([]*models.RequestRecord, error) {
+	s.mux.RLock()
+	tunnel, exists := s.tunnels[name]
+	s.mux.RUnlock()
+	if !exists {
+		return nil, fmt.Errorf("tunnel not found")
+	}
+	if len(har.Log.Entries) == 0 {
+		return nil, fmt.Errorf("har has no entries")
+	}
+
+	records := make([]*models.RequestRecord, 0, len(har.Log.Entries))
+	for i, entry := range har.Log.Entries {
+		if err := ctx.Err(); err != nil {
+			return records, err
+		}
+
+		original, err := recordFromHAR(entry)
+		if err != nil {
+			return records, fmt.Errorf("entry %d: %w", i, err)
+		}
+		record, err := s.replayRecord(ctx, name, tunnel, original, clientIP)
+		if err != nil {
+			return records, fmt.Errorf("entry %d: %w", i, err)
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+func harEntry(name string, record *models.RequestRecord) models.HAREntry {
+	target := strings.TrimSuffix(utils.TunnelURL(name), "/") + record.Path
+
+	var query []models.HARNameValue
+	if parsed, err := url.Parse(target); err == nil {
+		query = harValues(parsed.Query())
+	}
+
+	request := models.HARRequest{
+		Method:      record.Method,
+		URL:         target,
+		HTTPVersion: "HTTP/1.1",
+		Cookies:     []models.HARCookie{},
+		Headers:     harValues(record.Header),
+		QueryString: query,
+		HeadersSize: -1,
+		BodySize:    record.BodySize,
+		Path:        record.Path,
+	}
+	if record.BodySize > 0 {
+		text, encoding := harText(record.Body)
+		request.PostData = &models.HARPostData{
+			MimeType:  record.Header.Get("Content-Type"),
+			Text:      text,
+			Encoding:  encoding,
+			Truncated: record.BodyTruncated,
+			Comment:   truncatedComment(record.BodyTruncated, len(record.Body), record.BodySize),
+		}
+	}
+
+	response := models.HARResponse{
+		Status:      record.Status,
+		StatusText:  http.StatusText(record.Status),
+		HTTPVersion: "HTTP/1.1",
+		Cookies:     []models.HARCookie{},
+		Headers:     harValues(record.ResponseHeader),
+		Content: models.HARContent{
+			Size:     record.ResponseBodySize,
+			MimeType: record.ResponseHeader.Get("Content-Type"),
+			Comment:  truncatedComment(record.ResponseBodyTruncated, len(record.ResponseBody), record.ResponseBodySize),
+		},
+		RedirectURL: record.ResponseHeader.Get("Location"),
+		HeadersSize: -1,
+		BodySize:    record.ResponseBodySize,
+	}
+	response.Content.Text, response.Content.Encoding = harText(record.ResponseBody)
+
+	// blocked é a fila até o agente, wait a resposta dele e receive o resto
+	receive := record.Latency - record.QueueTime - record.WaitTime
+	if receive < 0 {
+		receive = 0
+	}
+	timings := models.HARTimings{
+		Blocked: milliseconds(record.QueueTime),
+		DNS:     -1,
+		Connect: -1,
+		Send:    0,
+		Wait:    milliseconds(record.WaitTime),
+		Receive: milliseconds(receive),
+		SSL:     -1,
+	}
+
+	entry := models.HAREntry{
+		StartedDateTime: record.StartedAt.Format(time.RFC3339Nano),
+		Time:            timings.Blocked + timings.Send + timings.Wait + timings.Receive,
+		Request:         request,
+		Response:        response,
+		Timings:         timings,
+		ID:              record.ID,
+		ClientIP:        record.ClientIP,
+		Error:           record.Error,
+	}
+	if record.Replay {
+		entry.Comment = "replay"
+	}
+	return entry
+}
+
+// recordFromHAR rebuilds the parts of a record needed to replay an entry.
+// The tunnel relative _path wins over the URL, so logs exported from one
+// tunnel can be replayed against another.
+func recordFromHAR(entry models.HAREntry) (*models.RequestRecord, error) {
+	if entry.Request.Method == "" {
+		return nil, fmt.Errorf("request method is missing")
+	}
+
+	path := entry.Request.Path
+	host := ""
+	if entry.Request.URL != "" {
+		parsed, err := url.Parse(entry.Request.URL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid request url: %w", err)
+		}
+		host = parsed.Host
+		if path == "" {
+			path = parsed.RequestURI()
+		}
+	}
+	if path == "" {
+		return nil, fmt.Errorf("request url is missing")
+	}
+
+	header := http.Header{}
+	for _, h := range entry.Request.Headers {
+		// Pseudo-cabeçalhos do HTTP/2 aparecem em HARs gravados por navegadores
+		if strings.HasPrefix(h.Name, ":") {
+			continue
+		}
+		header.Add(h.Name, h.Value)
+	}
+	header.Del("Content-Length")
+	if value := header.Get("Host"); value != "" {
+		host = value
+		header.Del("Host")
+	}
+
+	record := &models.RequestRecord{
+		Method: entry.Request.Method,
+		Path:   path,
+		Host:   host,
+		Header: header,
+	}
+	if data := entry.Request.PostData; data != nil {
+		body := []byte(data.Text)
+		if data.Encoding == "base64" {
+			decoded, err := base64.StdEncoding.DecodeString(data.Text)
+			if err != nil {
+				return nil, fmt.Errorf("invalid request body: %w", err)
+			}
+			body = decoded
+		}
+		record.Body = body
+		record.BodySize = int64(len(body))
+		record.BodyTruncated = data.Truncated
+		if data.MimeType != "" && header.Get("Content-Type") == "" {
+			header.Set("Content-Type", data.MimeType)
+		}
+	}
+	return record, nil
+}
+
+func harValues(values map[string][]string) []models.HARNameValue {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	list := []models.HARNameValue{}
+	for _, name := range names {
+		for _, value := range values[name] {
+			list = append(list, models.HARNameValue{Name: name, Value: value})
+		}
+	}
+	return list
+}
+
+// harText keeps text bodies readable and base64 encodes binary ones.
+func harText(body []byte) (string, string) {
+	if len(body) == 0 {
+		return "", ""
+	}
+	if utf8.Valid(body) {
+		return string(body), ""
+	}
+	return base64.StdEncoding.EncodeToString(body), "base64"
+}
+
+func truncatedComment(truncated bool, kept int, size int64) string {
+	if !truncated {
+		return ""
+	}
+	return fmt.Sprintf("body truncated to %d of %d bytes", kept, size)
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,217 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/config"
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/models"
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/repositories"
+)
+
+// binaryBody is not valid UTF-8, so HAR keeps it in base64.
+var binaryBody = []byte{0x89, 'P', 'N', 'G', 0x00, 0xff, 0xfe, '\r', '\n'}
+
+func TestHAREntry(t *testing.T) {
+	config.LoadAppConfig()
+	config.AppConfig.SUBDOMAIN = false
+	config.AppConfig.DOMAIN = "tunnerse.com"
+
+	record := &models.RequestRecord{
+		ID:        "req-1",
+		StartedAt: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		Method:    http.MethodPost,
+		Path:      "/upload?a=1&a=2&b=x",
+		ClientIP:  "203.0.113.7",
+		Header: http.Header{
+			"Content-Type": {"image/png"},
+			"Accept":       {"text/html", "application/json"},
+		},
+		Body:     binaryBody,
+		BodySize: int64(len(binaryBody)),
+
+		Status:                http.StatusCreated,
+		ResponseHeader:        http.Header{"Content-Type": {"text/plain"}, "Set-Cookie": {"a=1", "b=2"}},
+		ResponseBody:          []byte("stored"),
+		ResponseBodySize:      100,
+		ResponseBodyTruncated: true,
+
+		QueueTime: 10 * time.Millisecond,
+		WaitTime:  30 * time.Millisecond,
+		Latency:   45 * time.Millisecond,
+		Replay:    true,
+	}
+	entry := harEntry("demo-abc", record)
+
+	if entry.Request.URL != "https://tunnerse.com/demo-abc/upload?a=1&a=2&b=x" {
+		t.Errorf("url = %s", entry.Request.URL)
+	}
+	if entry.StartedDateTime != "2024-05-01T12:00:00Z" || entry.Comment != "replay" || entry.ID != "req-1" {
+		t.Errorf("entry = %s %q %s", entry.StartedDateTime, entry.Comment, entry.ID)
+	}
+
+	// Cabeçalhos e query repetidos viram uma entrada por valor, em ordem
+	wantHeaders := []models.HARNameValue{
+		{Name: "Accept", Value: "text/html"},
+		{Name: "Accept", Value: "application/json"},
+		{Name: "Content-Type", Value: "image/png"},
+	}
+	if !slices.Equal(entry.Request.Headers, wantHeaders) {
+		t.Errorf("request headers = %v, want %v", entry.Request.Headers, wantHeaders)
+	}
+	wantQuery := []models.HARNameValue{{Name: "a", Value: "1"}, {Name: "a", Value: "2"}, {Name: "b", Value: "x"}}
+	if !slices.Equal(entry.Request.QueryString, wantQuery) {
+		t.Errorf("query = %v, want %v", entry.Request.QueryString, wantQuery)
+	}
+	wantResponse := []models.HARNameValue{{Name: "Content-Type", Value: "text/plain"}, {Name: "Set-Cookie", Value: "a=1"}, {Name: "Set-Cookie", Value: "b=2"}}
+	if !slices.Equal(entry.Response.Headers, wantResponse) {
+		t.Errorf("response headers = %v, want %v", entry.Response.Headers, wantResponse)
+	}
+
+	// Corpo binário em base64, texto como está
+	post := entry.Request.PostData
+	if post == nil || post.Encoding != "base64" || post.MimeType != "image/png" {
+		t.Fatalf("postData = %+v, want base64 image/png", post)
+	}
+	if decoded, _ := base64.StdEncoding.DecodeString(post.Text); !bytes.Equal(decoded, binaryBody) {
+		t.Errorf("postData decodes to %v, want %v", decoded, binaryBody)
+	}
+	content := entry.Response.Content
+	if content.Text != "stored" || content.Encoding != "" || content.Size != 100 {
+		t.Errorf("content = %+v, want plain text of size 100", content)
+	}
+	if content.Comment != "body truncated to 6 of 100 bytes" {
+		t.Errorf("content comment = %q", content.Comment)
+	}
+
+	want := models.HARTimings{Blocked: 10, DNS: -1, Connect: -1, Send: 0, Wait: 30, Receive: 5, SSL: -1}
+	if entry.Timings != want || entry.Time != 45 {
+		t.Errorf("timings = %+v and time %v, want %+v and 45", entry.Timings, entry.Time, want)
+	}
+
+	// Latência menor que fila + espera não gera receive negativo
+	record.Latency = 20 * time.Millisecond
+	if timings := harEntry("demo-abc", record).Timings; timings.Receive != 0 {
+		t.Errorf("receive = %v, want 0", timings.Receive)
+	}
+}
+
+// answerAgent replies to the next request frame with status and body and
+// returns the request it answered.
+func answerAgent(t *testing.T, ws *websocket.Conn, status int, body string) *models.SerializableRequest {
+	t.Helper()
+	req := readFrame(t, ws, models.FrameRequest, 2*time.Second).Request
+	err := ws.WriteJSON(&models.Frame{
+		Type: models.FrameResponse,
+		Response: &models.ResponseData{
+			StatusCode: status,
+			Headers:    map[string][]string{"Content-Type": {"text/plain"}, "X-Reply": {"1", "2"}},
+			Body:       base64.StdEncoding.EncodeToString([]byte(body)),
+			Token:      req.Token,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return req
+}
+
+func TestHARExportImportRoundTrip(t *testing.T) {
+	config.LoadAppConfig()
+	config.AppConfig.SUBDOMAIN = false
+	config.AppConfig.TUNNEL_REQUEST_TIMEOUT = 5
+
+	svc := NewTunnelService(nil, repositories.NewMemoryTunnelRepository(), nil)
+	registered, err := svc.Register("har", models.TunnelOptions{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer svc.Close(registered.Name)
+	ws, _ := connectAgent(t, svc, registered.Name)
+
+	r := httptest.NewRequest(http.MethodPost, "/"+registered.Name+"/upload?v=1", bytes.NewReader(binaryBody))
+	r.Header.Set("Content-Type", "application/octet-stream")
+	r.Header.Add("X-Tag", "a")
+	r.Header.Add("X-Tag", "b")
+	done := make(chan error, 1)
+	go func() { done <- svc.Tunnel(registered.Name, r.URL.Path, "203.0.113.7", httptest.NewRecorder(), r) }()
+	answerAgent(t, ws, http.StatusCreated, "created")
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	// O HAR passa por JSON como num arquivo exportado
+	exported, err := svc.ExportHAR(registered.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(exported)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var har models.HAR
+	if err := json.Unmarshal(data, &har); err != nil {
+		t.Fatal(err)
+	}
+	if len(har.Log.Entries) != 1 {
+		t.Fatalf("exported %d entries, want 1", len(har.Log.Entries))
+	}
+	entry := har.Log.Entries[0]
+	if entry.Request.PostData == nil || entry.Request.PostData.Encoding != "base64" {
+		t.Fatalf("binary body exported as %+v", entry.Request.PostData)
+	}
+	if entry.Response.Status != http.StatusCreated || entry.Response.Content.Text != "created" {
+		t.Errorf("response = %d %q", entry.Response.Status, entry.Response.Content.Text)
+	}
+	tags := slices.DeleteFunc(slices.Clone(entry.Request.Headers), func(h models.HARNameValue) bool { return h.Name != "X-Tag" })
+	replies := slices.DeleteFunc(slices.Clone(entry.Response.Headers), func(h models.HARNameValue) bool { return h.Name != "X-Reply" })
+	if len(tags) != 2 || len(replies) != 2 {
+		t.Errorf("repeated headers exported as %v and %v", tags, replies)
+	}
+	timings := entry.Timings
+	if timings.Blocked < 0 || timings.Wait < 0 || timings.Receive < 0 || entry.Time != timings.Blocked+timings.Send+timings.Wait+timings.Receive {
+		t.Errorf("timings = %+v with time %v", timings, entry.Time)
+	}
+
+	// O import reenvia a mesma requisição ao agente
+	imported := make(chan []*models.RequestRecord, 1)
+	go func() {
+		records, err := svc.ImportHAR(context.Background(), registered.Name, &har, "198.51.100.1")
+		if err != nil {
+			t.Error(err)
+		}
+		imported <- records
+	}()
+	replayed := answerAgent(t, ws, http.StatusOK, "again")
+	records := <-imported
+
+	if replayed.Method != http.MethodPost || replayed.Path != "/upload?v=1" {
+		t.Errorf("agent got %s %s, want POST /upload?v=1", replayed.Method, replayed.Path)
+	}
+	if got := replayed.Header["X-Tag"]; !slices.Equal(got, []string{"a", "b"}) {
+		t.Errorf("agent got X-Tag = %v, want [a b]", got)
+	}
+	if len(records) != 1 {
+		t.Fatalf("imported %d records, want 1", len(records))
+	}
+	if !bytes.Equal(records[0].Body, binaryBody) || !records[0].Replay || records[0].Status != http.StatusOK {
+		t.Errorf("replayed record = body %v replay %v status %d", records[0].Body, records[0].Replay, records[0].Status)
+	}
+
+	again, err := svc.ExportHAR(registered.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(again.Log.Entries); n != 2 || again.Log.Entries[1].Comment != "replay" {
+		t.Errorf("history after import has %d entries, want the replay last", n)
+	}
+}
@@ -0,0 +1,277 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/config"
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/logger"
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/models"
+)
+
+// historyRing keeps the most recent exchanges of a tunnel, dropping the
+// oldest once it is full.
+type historyRing struct {
+	records     []*models.RequestRecord
+	next        int
+	full        bool
+	subscribers map[chan *models.RequestRecord]struct{} // Inspetores recebendo as trocas ao vivo
+	mu          sync.RWMutex
+}
+
+func newHistoryRing(size int) *historyRing {
+	if size <= 0 {
+		return nil
+	}
+	return &historyRing{
+		records:     make([]*models.RequestRecord, size),
+		subscribers: make(map[chan *models.RequestRecord]struct{}),
+	}
+}
+
+func (h *historyRing) add(record *models.RequestRecord) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.records[h.next] = record
+	h.next = (h.next + 1) % len(h.records)
+	if h.next == 0 {
+		h.full = true
+	}
+
+	// Inspetores lentos perdem o evento em vez de travar o túnel
+	for ch := range h.subscribers {
+		select {
+		case ch <- record:
+		default:
+		}
+	}
+}
+
+// subscribe returns a channel fed with every record added from now on and a
+// function that stops the feed.
+func (h *historyRing) subscribe() (<-chan *models.RequestRecord, func()) {
+	ch := make(chan *models.RequestRecord, 32)
+
+	h.mu.Lock()
+	h.subscribers[ch] = struct{}{}
+	h.mu.Unlock()
+
+	return ch, func() {
+		h.mu.Lock()
+		delete(h.subscribers, ch)
+		h.mu.Unlock()
+	}
+}
+
+// list returns the records oldest first.
+func (h *historyRing) list() []*models.RequestRecord {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if !h.full {
+		return append([]*models.RequestRecord(nil), h.records[:h.next]...)
+	}
+	records := make([]*models.RequestRecord, 0, len(h.records))
+	records = append(records, h.records[h.next:]...)
+	return append(records, h.records[:h.next]...)
+}
+
+func (h *historyRing) find(id string) *models.RequestRecord {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for _, record := range h.records {
+		if record != nil && record.ID == id {
+			return record
+		}
+	}
+	return nil
+}
+
+// previewBuffer keeps the first HISTORY_BODY_LIMIT bytes written to it and
+// counts the rest. Writes never fail, so it can sit in a tee.
+type previewBuffer struct {
+	buf       bytes.Buffer
+	size      int64
+	truncated bool
+	mu        sync.Mutex
+}
+
+func newPreviewBuffer() *previewBuffer {
+	return &previewBuffer{}
+}
+
+func (p *previewBuffer) Write(data []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.size += int64(len(data))
+	room := config.AppConfig.HISTORY_BODY_LIMIT - p.buf.Len()
+	if room < len(data) {
+		p.truncated = true
+		if room > 0 {
+			p.buf.Write(data[:room])
+		}
+		return len(data), nil
+	}
+	p.buf.Write(data)
+	return len(data), nil
+}
+
+func (p *previewBuffer) result() ([]byte, int64, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.size == 0 {
+		return nil, 0, false
+	}
+	return bytes.Clone(p.buf.Bytes()), p.size, p.truncated
+}
+
+type teeReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// replayWriter answers replayed requests, whose response only ends up in the
+// history.
+type replayWriter struct {
+	header http.Header
+}
+
+func (w *replayWriter) Header() http.Header         { return w.header }
+func (w *replayWriter) Write(p []byte) (int, error) { return len(p), nil }
+func (w *replayWriter) WriteHeader(int)             {}
+
+func (s *TunnelService) saveRecord(tunnel *Tunnel, record *models.RequestRecord) {
+	if tunnel.history == nil {
+		return
+	}
+	tunnel.history.add(record)
+
+	if s.history == nil {
+		return
+	}
+	if err := s.history.Append(context.Background(), record, config.AppConfig.HISTORY_SIZE); err != nil {
+		logger.Log("ERROR", "Failed to save request history", []logger.LogDetail{
+			{Key: "tunnel", Value: record.Tunnel},
+			{Key: "Error", Value: err.Error()},
+		})
+	}
+}
+
+// logRecord writes the access log line of an exchange.
+func logRecord(record *models.RequestRecord) {
+	details := []logger.LogDetail{
+		{Key: "tunnel", Value: record.Tunnel},
+		{Key: "token", Value: record.Token},
+		{Key: "client_ip", Value: record.ClientIP},
+		{Key: "method", Value: record.Method},
+		{Key: "path", Value: record.Path},
+		{Key: "status", Value: record.Status},
+		{Key: "latency", Value: record.Latency},
+	}
+	if record.Replay {
+		details = append(details, logger.LogDetail{Key: "replay", Value: true})
+	}
+	if record.Error != "" {
+		logger.Log("WARN", "Request has failed", append(details, logger.LogDetail{Key: "Error", Value: record.Error}))
+		return
+	}
+	logger.Log("INFO", "Message has been written", details)
+}
+
+// loadHistory fills the ring of a restored tunnel with the persisted records.
+func (s *TunnelService) loadHistory(name string, tunnel *Tunnel) {
+	if tunnel.history == nil || s.history == nil {
+		return
+	}
+
+	records, err := s.history.List(context.Background(), name)
+	if err != nil {
+		logger.Log("ERROR", "Failed to load request history", []logger.LogDetail{
+			{Key: "tunnel", Value: name},
+			{Key: "Error", Value: err.Error()},
+		})
+		return
+	}
+	for _, record := range records {
+		tunnel.history.add(record)
+	}
+}
+
+func (s *TunnelService) Requests(name string) ([]*models.RequestRecord, error) {
+	s.mux.RLock()
+	tunnel, exists := s.tunnels[name]
+	s.mux.RUnlock()
+	if !exists {
+		return nil, fmt.Errorf("tunnel not found")
+	}
+	if tunnel.history == nil {
+		return []*models.RequestRecord{}, nil
+	}
+	return tunnel.history.list(), nil
+}
+
+// Replay sends a recorded request through the tunnel again, skipping the
+// public access checks, and returns the record of the new exchange.
+func (s *TunnelService) Replay(ctx context.Context, name, id, clientIP string) (*models.RequestRecord, error) {
+	s.mux.RLock()
+	tunnel, exists := s.tunnels[name]
+	s.mux.RUnlock()
+	if !exists {
+		return nil, fmt.Errorf("tunnel not found")
+	}
+
+	var original *models.RequestRecord
+	if tunnel.history != nil {
+		original = tunnel.history.find(id)
+	}
+	if original == nil {
+		return nil, fmt.Errorf("request not found")
+	}
+
+	return s.replayRecord(ctx, name, tunnel, original, clientIP)
+}
+
+func (s *TunnelService) replayRecord(ctx context.Context, name string, tunnel *Tunnel, original *models.RequestRecord, clientIP string) (*models.RequestRecord, error) {
+	if original.BodyTruncated {
+		return nil, fmt.Errorf("request body was not fully recorded")
+	}
+
+	target, err := url.ParseRequestURI(original.Path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid recorded path: %w", err)
+	}
+	path := target.Path
+	if !config.AppConfig.SUBDOMAIN {
+		target.Path = "/" + name + target.Path
+	}
+
+	req, err := http.NewRequestWithContext(ctx, original.Method, target.String(), bytes.NewReader(original.Body))
+	if err != nil {
+		return nil, fmt.Errorf("invalid recorded request: %w", err)
+	}
+	req.Header = original.Header.Clone()
+	if req.Header == nil {
+		req.Header = http.Header{}
+	}
+	req.Host = original.Host
+	req.RequestURI = target.RequestURI()
+	if isUpgradeRequest(req) {
+		return nil, fmt.Errorf("upgrade requests cannot be replayed")
+	}
+
+	record := &models.RequestRecord{Replay: true}
+	err = s.relay(name, path, clientIP, tunnel, &replayWriter{header: http.Header{}}, req, record)
+	if err != nil && record.ID == "" {
+		return nil, err
+	}
+	return record, nil
+}
@@ -0,0 +1,83 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const inspectorKeepAlive = 15 * time.Second
+
+// Inspector serves the traffic inspector page of a tunnel. The page itself
+// is public; the history it reads still requires the tunnel secret.
+func (s *TunnelService) Inspector(name string, w http.ResponseWriter) error {
+	s.mux.RLock()
+	_, exists := s.tunnels[name]
+	s.mux.RUnlock()
+	if !exists {
+		return fmt.Errorf("tunnel not found")
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	s.serveHTML(w, http.StatusOK, "tunnel-inspector", "inspector", "inspector page not found")
+	return nil
+}
+
+// Watch streams every new exchange of the tunnel as Server-Sent Events until
+// the client disconnects or the tunnel is closed.
+func (s *TunnelService) Watch(name string, w http.ResponseWriter, r *http.Request) error {
+	s.mux.RLock()
+	tunnel, exists := s.tunnels[name]
+	s.mux.RUnlock()
+	if !exists {
+		return fmt.Errorf("tunnel not found")
+	}
+	if tunnel.history == nil {
+		return fmt.Errorf("request history is disabled")
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return fmt.Errorf("connection does not support streaming")
+	}
+
+	records, unsubscribe := tunnel.history.subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	// Impede que proxies reversos segurem os eventos em buffer
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, "retry: 3000\n\n")
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(inspectorKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case record := <-records:
+			data, err := json.Marshal(record)
+			if err != nil {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "id: %s\nevent: request\ndata: %s\n\n", record.ID, data); err != nil {
+				return nil
+			}
+			flusher.Flush()
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return nil
+			}
+			flusher.Flush()
+		case <-tunnel.done:
+			fmt.Fprint(w, "event: closed\ndata: {}\n\n")
+			flusher.Flush()
+			return nil
+		case <-r.Context().Done():
+			return nil
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package services
+
+import (
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/metrics"
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/models"
+)
+
+// observe feeds the metrics of a finished exchange. queued tells whether the
+// agent took the request, so the wait histograms only see requests that
+// reached it. The tunnel series are skipped once the tunnel is closed: the
+// cleanup sets closed under t.mu before calling metrics.ForgetTunnel, so a
+// late exchange cannot bring them back.
+func (t *Tunnel) observe(record *models.RequestRecord, queued bool) {
+	if queued {
+		metrics.QueueWait.Observe(record.QueueTime.Seconds())
+		metrics.ResponseWait.Observe(record.WaitTime.Seconds())
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return
+	}
+
+	metrics.Requests.WithLabelValues(record.Tunnel, metrics.StatusClass(record.Status)).Inc()
+	metrics.BytesIn.WithLabelValues(record.Tunnel).Add(float64(record.BodySize))
+	metrics.BytesOut.WithLabelValues(record.Tunnel).Add(float64(record.ResponseBodySize))
+
+	switch record.Error {
+	case "timeout":
+		metrics.Timeouts.WithLabelValues(record.Tunnel).Inc()
+	case "local-api-error":
+		metrics.LocalAPIErrors.WithLabelValues(record.Tunnel).Inc()
+	}
+}
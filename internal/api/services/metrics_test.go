@@ -0,0 +1,85 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/config"
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/metrics"
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/models"
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/repositories"
+)
+
+func TestObserveSkipsClosedTunnel(t *testing.T) {
+	tunnel := &Tunnel{}
+	record := &models.RequestRecord{Tunnel: "metrics-demo", Status: 200, BodySize: 10, ResponseBodySize: 20}
+
+	tunnel.observe(record, true)
+	if got := testutil.ToFloat64(metrics.Requests.WithLabelValues("metrics-demo", "2xx")); got != 1 {
+		t.Fatalf("requests = %v, want 1", got)
+	}
+
+	// Mesma ordem da limpeza do túnel: closed sob t.mu e depois ForgetTunnel
+	tunnel.mu.Lock()
+	tunnel.closed = true
+	tunnel.mu.Unlock()
+	metrics.ForgetTunnel("metrics-demo")
+
+	tunnel.observe(record, true)
+	for name, vec := range map[string]interface{ DeleteLabelValues(...string) bool }{
+		"requests":  metrics.Requests,
+		"bytes_in":  metrics.BytesIn,
+		"bytes_out": metrics.BytesOut,
+	} {
+		labels := []string{"metrics-demo"}
+		if name == "requests" {
+			labels = append(labels, "2xx")
+		}
+		if vec.DeleteLabelValues(labels...) {
+			t.Errorf("%s series of a closed tunnel came back", name)
+		}
+	}
+}
+
+func TestForgetTunnelKeepsOtherTunnels(t *testing.T) {
+	metrics.Timeouts.WithLabelValues("forget-a").Inc()
+	metrics.Timeouts.WithLabelValues("forget-b").Inc()
+	metrics.Requests.WithLabelValues("forget-a", "5xx").Inc()
+
+	metrics.ForgetTunnel("forget-a")
+
+	if metrics.Timeouts.DeleteLabelValues("forget-a") || metrics.Requests.DeleteLabelValues("forget-a", "5xx") {
+		t.Error("series of the forgotten tunnel were kept")
+	}
+	if !metrics.Timeouts.DeleteLabelValues("forget-b") {
+		t.Error("series of another tunnel were dropped")
+	}
+}
+
+func TestLateExchangeKeepsSeriesForgotten(t *testing.T) {
+	config.LoadAppConfig()
+	svc := NewTunnelService(nil, repositories.NewMemoryTunnelRepository(), nil)
+	registered, err := svc.Register("late", models.TunnelOptions{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc.mux.RLock()
+	tunnel := svc.tunnels[registered.Name]
+	svc.mux.RUnlock()
+
+	// A limpeza esquece as séries logo depois de fechar done; repetir aqui fixa a ordem
+	svc.Close(registered.Name)
+	<-tunnel.done
+	metrics.ForgetTunnel(registered.Name)
+
+	// Um relay ou pipe ainda em andamento usa as séries do túnel já fechado
+	tunnel.pending.Inc()
+	tunnel.bytesIn.Add(10)
+	tunnel.bytesOut.Add(10)
+	if metrics.PendingRequests.DeleteLabelValues(registered.Name) ||
+		metrics.BytesIn.DeleteLabelValues(registered.Name) ||
+		metrics.BytesOut.DeleteLabelValues(registered.Name) {
+		t.Error("series of a closed tunnel came back")
+	}
+}
@@ -0,0 +1,186 @@
+package services
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/logger"
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/models"
+)
+
+// muxConn is a persistent agent connection. Each frame travels as one JSON
+// text message; requests are pushed as soon as they are queued and responses
+// may arrive in any order.
+type muxConn struct {
+	ws *websocket.Conn
+	mu sync.Mutex
+}
+
+func (m *muxConn) send(frame *models.Frame) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.ws.WriteJSON(frame)
+}
+
+// Connect upgrades the agent connection carried by r into a persistent,
+// multiplexed WebSocket for the tunnel. It returns once the handshake is done;
+// frames are served in the background until either side closes.
+func (s *TunnelService) Connect(name string, w http.ResponseWriter, r *http.Request) error {
+	s.mux.RLock()
+	tunnel, exists := s.tunnels[name]
+	s.mux.RUnlock()
+	if !exists {
+		return fmt.Errorf("tunnel not found")
+	}
+
+	tunnel.mu.Lock()
+	if tunnel.closed {
+		tunnel.mu.Unlock()
+		return fmt.Errorf("tunnel is closed")
+	}
+	if tunnel.resetTimer != nil {
+		tunnel.resetTimer()
+	}
+	tunnel.mu.Unlock()
+
+	ws, err := upgradeAgent(w, r)
+	if err != nil {
+		return err
+	}
+
+	go s.serveMux(name, tunnel, &muxConn{ws: ws})
+	return nil
+}
+
+// currentMux returns the most recent persistent connection of the agent, used
+// for traffic that can only flow over it, such as datagrams.
+func (t *Tunnel) currentMux() *muxConn {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.muxConns) == 0 {
+		return nil
+	}
+	return t.muxConns[len(t.muxConns)-1]
+}
+
+func (t *Tunnel) attachMux(conn *muxConn) {
+	t.mu.Lock()
+	t.muxConns = append(t.muxConns, conn)
+	t.mu.Unlock()
+}
+
+func (t *Tunnel) detachMux(conn *muxConn) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i, c := range t.muxConns {
+		if c == conn {
+			t.muxConns = append(t.muxConns[:i], t.muxConns[i+1:]...)
+			return
+		}
+	}
+}
+
+// requeue gives a request that could not be written to a dead agent
+// connection to another receiver already waiting on the queue. When there is
+// none, its pending entry fails right away instead of waiting for the request
+// timeout. The send happens under t.mu, so it never races the close of
+// requestCh in the tunnel cleanup.
+func (t *Tunnel) requeue(req *http.Request) {
+	token := req.Header.Get("Tunnerse-Request-Token")
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return
+	}
+
+	select {
+	case t.requestCh <- req:
+		return
+	default:
+	}
+
+	if ch, ok := t.pendingRequests[token]; ok {
+		delete(t.pendingRequests, token)
+		ch <- &ResponseWithToken{Err: fmt.Errorf("agent connection lost")}
+	}
+	if ch, ok := t.pendingStreams[token]; ok {
+		delete(t.pendingStreams, token)
+		close(ch)
+	}
+}
+
+func (s *TunnelService) serveMux(name string, tunnel *Tunnel, conn *muxConn) {
+	defer conn.ws.Close()
+
+	tunnel.attachMux(conn)
+	defer tunnel.detachMux(conn)
+
+	logger.Log("DEBUG", "Agent connection opened", []logger.LogDetail{{Key: "tunnel", Value: name}})
+	defer logger.Log("DEBUG", "Agent connection closed", []logger.LogDetail{{Key: "tunnel", Value: name}})
+
+	readerDone := make(chan struct{})
+	go func() {
+		defer close(readerDone)
+		for {
+			var frame models.Frame
+			if err := conn.ws.ReadJSON(&frame); err != nil {
+				return
+			}
+			tunnel.touch()
+
+			switch frame.Type {
+			case models.FrameResponse:
+				if frame.Response == nil {
+					continue
+				}
+				if err := s.deliver(name, tunnel, frame.Response); err != nil {
+					logger.Log("DEBUG", "Failed to deliver multiplexed response", []logger.LogDetail{
+						{Key: "tunnel", Value: name},
+						{Key: "Error", Value: err.Error()},
+					})
+				}
+			case models.FrameDatagram:
+				if frame.Datagram == nil {
+					continue
+				}
+				if err := s.replyUDP(tunnel, frame.Datagram); err != nil {
+					logger.Log("DEBUG", "Failed to deliver datagram", []logger.LogDetail{
+						{Key: "tunnel", Value: name},
+						{Key: "Error", Value: err.Error()},
+					})
+				}
+			}
+		}
+	}()
+
+	for {
+		select {
+		case req, ok := <-tunnel.requestCh:
+			if !ok || req == nil {
+				return
+			}
+
+			sreq, err := serializeRequest(req)
+			if err != nil {
+				logger.Log("ERROR", "Failed to serialize request", []logger.LogDetail{
+					{Key: "tunnel", Value: name},
+					{Key: "Error", Value: err.Error()},
+				})
+				continue
+			}
+
+			if err := conn.send(&models.Frame{Type: models.FrameRequest, Request: sreq}); err != nil {
+				tunnel.requeue(req)
+				return
+			}
+		case <-readerDone:
+			return
+		case <-tunnel.done:
+			return
+		}
+	}
+}
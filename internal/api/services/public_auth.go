@@ -0,0 +1,96 @@
+package services
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/models"
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/utils"
+)
+
+const (
+	accessTokenParam  = "tunnerse_token"
+	accessTokenHeader = "Tunnerse-Access-Token"
+	accessTokenCookie = "tunnerse_token"
+)
+
+// authorizePublic checks the credentials of a public request against the
+// protection chosen on register. A valid token in the query string is kept in
+// a cookie, so pages opened from a shared link can load their assets.
+func authorizePublic(auth *models.TunnelAuth, w http.ResponseWriter, r *http.Request, cookiePath string) bool {
+	if auth == nil {
+		return true
+	}
+
+	if len(auth.PasswordHash) > 0 {
+		if username, password, ok := r.BasicAuth(); ok &&
+			subtle.ConstantTimeCompare([]byte(username), []byte(auth.Username)) == 1 &&
+			utils.MatchPassword(password, auth.PasswordHash) {
+			return true
+		}
+	}
+
+	if len(auth.TokenHash) > 0 {
+		if utils.MatchSecret(r.Header.Get(accessTokenHeader), auth.TokenHash) {
+			return true
+		}
+		if cookie, err := r.Cookie(accessTokenCookie); err == nil && utils.MatchSecret(cookie.Value, auth.TokenHash) {
+			return true
+		}
+		if token := r.URL.Query().Get(accessTokenParam); utils.MatchSecret(token, auth.TokenHash) {
+			http.SetCookie(w, &http.Cookie{
+				Name:     accessTokenCookie,
+				Value:    token,
+				Path:     cookiePath,
+				HttpOnly: true,
+				Secure:   true,
+				SameSite: http.SameSiteLaxMode,
+			})
+			return true
+		}
+	}
+
+	if len(auth.PasswordHash) > 0 {
+		w.Header().Set("WWW-Authenticate", `Basic realm="Tunnerse", charset="UTF-8"`)
+	} else {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="Tunnerse"`)
+	}
+	return false
+}
+
+// stripPublicCredentials removes the tunnel credentials from a request before
+// it reaches the local app.
+func stripPublicCredentials(auth *models.TunnelAuth, req *http.Request) {
+	if auth == nil {
+		return
+	}
+
+	if len(auth.PasswordHash) > 0 {
+		req.Header.Del("Authorization")
+	}
+
+	if len(auth.TokenHash) == 0 {
+		return
+	}
+
+	req.Header.Del(accessTokenHeader)
+
+	if query := req.URL.Query(); query.Has(accessTokenParam) {
+		query.Del(accessTokenParam)
+		req.URL.RawQuery = query.Encode()
+	}
+
+	if cookies := req.Cookies(); len(cookies) > 0 {
+		kept := make([]string, 0, len(cookies))
+		for _, cookie := range cookies {
+			if cookie.Name != accessTokenCookie {
+				kept = append(kept, cookie.String())
+			}
+		}
+		req.Header.Del("Cookie")
+		if len(kept) > 0 {
+			req.Header.Set("Cookie", strings.Join(kept, "; "))
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/config"
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/models"
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/repositories"
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/utils"
+)
+
+func testAuth(t *testing.T, username, password, token string) *models.TunnelAuth {
+	t.Helper()
+	auth := &models.TunnelAuth{Username: username}
+	if password != "" {
+		hash, err := utils.HashPassword(password)
+		if err != nil {
+			t.Fatal(err)
+		}
+		auth.PasswordHash = hash
+	}
+	if token != "" {
+		auth.TokenHash = utils.HashSecret(token)
+	}
+	return auth
+}
+
+func TestAuthorizePublic(t *testing.T) {
+	basic := testAuth(t, "admin", "s3cret", "")
+	bearer := testAuth(t, "", "", "tok")
+	both := testAuth(t, "admin", "s3cret", "tok")
+
+	tests := []struct {
+		name      string
+		auth      *models.TunnelAuth
+		prepare   func(r *http.Request)
+		want      bool
+		challenge string
+		cookie    bool
+	}{
+		{name: "no auth", auth: nil, want: true},
+		{
+			name:    "basic ok",
+			auth:    basic,
+			prepare: func(r *http.Request) { r.SetBasicAuth("admin", "s3cret") },
+			want:    true,
+		},
+		{
+			name:      "basic wrong password",
+			auth:      basic,
+			prepare:   func(r *http.Request) { r.SetBasicAuth("admin", "s3cret!") },
+			challenge: `Basic realm="Tunnerse", charset="UTF-8"`,
+		},
+		{
+			name:      "basic wrong username",
+			auth:      basic,
+			prepare:   func(r *http.Request) { r.SetBasicAuth("root", "s3cret") },
+			challenge: `Basic realm="Tunnerse", charset="UTF-8"`,
+		},
+		{
+			name:      "basic empty password",
+			auth:      basic,
+			prepare:   func(r *http.Request) { r.SetBasicAuth("admin", "") },
+			challenge: `Basic realm="Tunnerse", charset="UTF-8"`,
+		},
+		{
+			name:      "basic missing credentials",
+			auth:      basic,
+			challenge: `Basic realm="Tunnerse", charset="UTF-8"`,
+		},
+		{
+			name:    "token header",
+			auth:    bearer,
+			prepare: func(r *http.Request) { r.Header.Set(accessTokenHeader, "tok") },
+			want:    true,
+		},
+		{
+			name:    "token cookie",
+			auth:    bearer,
+			prepare: func(r *http.Request) { r.AddCookie(&http.Cookie{Name: accessTokenCookie, Value: "tok"}) },
+			want:    true,
+		},
+		{
+			name:    "token query sets cookie",
+			auth:    bearer,
+			prepare: func(r *http.Request) { r.URL.RawQuery = accessTokenParam + "=tok" },
+			want:    true,
+			cookie:  true,
+		},
+		{
+			name:      "wrong token",
+			auth:      bearer,
+			prepare:   func(r *http.Request) { r.Header.Set(accessTokenHeader, "other") },
+			challenge: `Bearer realm="Tunnerse"`,
+		},
+		{
+			name:      "token missing credentials",
+			auth:      bearer,
+			challenge: `Bearer realm="Tunnerse"`,
+		},
+		{
+			name:    "both accepts token alone",
+			auth:    both,
+			prepare: func(r *http.Request) { r.Header.Set(accessTokenHeader, "tok") },
+			want:    true,
+		},
+		{
+			name:      "both rejects token as password",
+			auth:      both,
+			prepare:   func(r *http.Request) { r.SetBasicAuth("admin", "tok") },
+			challenge: `Basic realm="Tunnerse", charset="UTF-8"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/app", nil)
+			if tt.prepare != nil {
+				tt.prepare(r)
+			}
+			w := httptest.NewRecorder()
+
+			if got := authorizePublic(tt.auth, w, r, "/app"); got != tt.want {
+				t.Fatalf("authorizePublic() = %v, want %v", got, tt.want)
+			}
+			if got := w.Header().Get("WWW-Authenticate"); got != tt.challenge {
+				t.Errorf("WWW-Authenticate = %q, want %q", got, tt.challenge)
+			}
+
+			cookies := w.Result().Cookies()
+			if tt.cookie != (len(cookies) == 1) {
+				t.Fatalf("cookies = %v, want cookie: %v", cookies, tt.cookie)
+			}
+			if tt.cookie {
+				if c := cookies[0]; c.Name != accessTokenCookie || c.Value != "tok" || c.Path != "/app" || !c.HttpOnly {
+					t.Errorf("unexpected cookie %+v", c)
+				}
+			}
+		})
+	}
+}
+
+func TestStripPublicCredentials(t *testing.T) {
+	newRequest := func() *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/app?"+accessTokenParam+"=tok&page=2", nil)
+		r.SetBasicAuth("admin", "s3cret")
+		r.Header.Set(accessTokenHeader, "tok")
+		r.AddCookie(&http.Cookie{Name: "session", Value: "abc"})
+		r.AddCookie(&http.Cookie{Name: accessTokenCookie, Value: "tok"})
+		return r
+	}
+
+	t.Run("no auth keeps everything", func(t *testing.T) {
+		r := newRequest()
+		stripPublicCredentials(nil, r)
+		if r.Header.Get("Authorization") == "" || r.Header.Get(accessTokenHeader) == "" {
+			t.Errorf("credentials removed from an unprotected tunnel: %v", r.Header)
+		}
+	})
+
+	t.Run("password strips authorization only", func(t *testing.T) {
+		r := newRequest()
+		stripPublicCredentials(testAuth(t, "admin", "s3cret", ""), r)
+		if got := r.Header.Get("Authorization"); got != "" {
+			t.Errorf("Authorization = %q, want it removed", got)
+		}
+		if r.Header.Get(accessTokenHeader) == "" || !r.URL.Query().Has(accessTokenParam) {
+			t.Errorf("token removed from a tunnel without token auth")
+		}
+	})
+
+	t.Run("token strips header, query and cookie", func(t *testing.T) {
+		r := newRequest()
+		stripPublicCredentials(testAuth(t, "", "", "tok"), r)
+		if got := r.Header.Get(accessTokenHeader); got != "" {
+			t.Errorf("%s = %q, want it removed", accessTokenHeader, got)
+		}
+		if got := r.URL.RawQuery; got != "page=2" {
+			t.Errorf("query = %q, want %q", got, "page=2")
+		}
+		if got := r.Header.Get("Cookie"); got != "session=abc" {
+			t.Errorf("Cookie = %q, want %q", got, "session=abc")
+		}
+		if r.Header.Get("Authorization") == "" {
+			t.Errorf("Authorization removed from a tunnel without password auth")
+		}
+	})
+}
+
+func TestTunnelStripsCredentialsBeforeAgent(t *testing.T) {
+	config.LoadAppConfig()
+	config.AppConfig.SUBDOMAIN = false
+	config.AppConfig.TUNNEL_REQUEST_TIMEOUT = 5
+
+	svc := NewTunnelService(nil, repositories.NewMemoryTunnelRepository(), nil)
+	registered, err := svc.Register("", models.TunnelOptions{Auth: testAuth(t, "admin", "s3cret", "")}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer svc.Close(registered.Name)
+
+	r := httptest.NewRequest(http.MethodGet, "/"+registered.Name+"/app", nil)
+	r.SetBasicAuth("admin", "s3cret")
+	r.Header.Set("X-App", "kept")
+
+	done := make(chan error, 1)
+	go func() {
+		done <- svc.Tunnel(registered.Name, r.URL.Path, "127.0.0.1", httptest.NewRecorder(), r)
+	}()
+
+	svc.mux.RLock()
+	tunnel := svc.tunnels[registered.Name]
+	svc.mux.RUnlock()
+
+	var queued *http.Request
+	select {
+	case queued = <-tunnel.requestCh:
+	case err := <-done:
+		t.Fatalf("Tunnel() returned before queueing: %v", err)
+	}
+
+	if got := queued.Header.Get("Authorization"); got != "" {
+		t.Errorf("agent received Authorization = %q", got)
+	}
+	if got := queued.Header.Get("X-App"); got != "kept" {
+		t.Errorf("agent received X-App = %q, want %q", got, "kept")
+	}
+	if got := r.Header.Get("Authorization"); got == "" {
+		t.Errorf("the original request lost its Authorization header")
+	}
+
+	svc.Close(registered.Name)
+	<-done
+}
@@ -0,0 +1,204 @@
+package services
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// agentUpgrader accepts the WebSocket connections of the agent. The agent is
+// authenticated by its tunnel secret, not by cookies, so any origin is fine.
+var agentUpgrader = websocket.Upgrader{
+	ReadBufferSize:  32 * 1024,
+	WriteBufferSize: 32 * 1024,
+	CheckOrigin:     func(*http.Request) bool { return true },
+}
+
+// streamKey marks queued requests whose body is relayed through an agent
+// stream instead of being serialized into JSON.
+type streamKey struct{}
+
+func isStreamRequest(r *http.Request) bool {
+	streaming, _ := r.Context().Value(streamKey{}).(bool)
+	return streaming || isUpgradeRequest(r) || isRawRequest(r)
+}
+
+// Hop-by-hop headers are meaningful only for the agent connection.
+var hopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Connection",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+func removeHopHeaders(h http.Header) {
+	for _, key := range hopHeaders {
+		h.Del(key)
+	}
+}
+
+// wsStream carries a byte stream over WebSocket binary messages: every Write
+// is sent as one message and Read goes through the messages in order.
+type wsStream struct {
+	conn    *websocket.Conn
+	reader  io.Reader
+	writeMu sync.Mutex
+	close   func() error
+}
+
+func newWSStream(conn *websocket.Conn) *wsStream {
+	stream := &wsStream{conn: conn}
+	stream.close = sync.OnceValue(func() error {
+		stream.writeMu.Lock()
+		conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+		stream.writeMu.Unlock()
+		return conn.Close()
+	})
+	return stream
+}
+
+func (s *wsStream) Read(p []byte) (int, error) {
+	for {
+		if s.reader == nil {
+			messageType, reader, err := s.conn.NextReader()
+			if err != nil {
+				if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+					return 0, io.EOF
+				}
+				return 0, err
+			}
+			if messageType != websocket.BinaryMessage {
+				continue
+			}
+			s.reader = reader
+		}
+
+		n, err := s.reader.Read(p)
+		if err == io.EOF {
+			s.reader = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+func (s *wsStream) Write(p []byte) (int, error) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	if err := s.conn.WriteMessage(websocket.BinaryMessage, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (s *wsStream) Close() error {
+	return s.close()
+}
+
+// flushWriter pushes every chunk to the client right away, so chunked
+// responses and Server-Sent Events arrive as the local API produces them.
+type flushWriter struct {
+	w       io.Writer
+	flusher http.Flusher
+}
+
+func newFlushWriter(w http.ResponseWriter) *flushWriter {
+	flusher, _ := w.(http.Flusher)
+	return &flushWriter{w: w, flusher: flusher}
+}
+
+func (f *flushWriter) Write(p []byte) (int, error) {
+	n, err := f.w.Write(p)
+	if f.flusher != nil {
+		f.flusher.Flush()
+	}
+	return n, err
+}
+
+// activityWriter resets the tunnel inactivity timer on every chunk relayed
+// and, when bytes is set, counts what was written.
+type activityWriter struct {
+	w     io.Writer
+	touch func()
+	bytes prometheus.Counter
+}
+
+func (a *activityWriter) Write(p []byte) (int, error) {
+	a.touch()
+	n, err := a.w.Write(p)
+	if a.bytes != nil {
+		a.bytes.Add(float64(n))
+	}
+	return n, err
+}
+
+// upgradeAgent completes the WebSocket handshake of an agent connection. On
+// failure the upgrader has already answered the request with an HTTP error.
+func upgradeAgent(w http.ResponseWriter, r *http.Request) (*websocket.Conn, error) {
+	conn, err := agentUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to upgrade agent connection: %w", err)
+	}
+	return conn, nil
+}
+
+// waitStream blocks until the agent attaches the stream for a queued request.
+func waitStream(streamCh chan io.ReadWriteCloser, timeout time.Duration, r *http.Request) (io.ReadWriteCloser, error) {
+	select {
+	case stream := <-streamCh:
+		if stream == nil {
+			return nil, fmt.Errorf("stream unavailable: tunnel closed or agent disconnected")
+		}
+		return stream, nil
+	case <-time.After(timeout):
+		return nil, fmt.Errorf("timeout")
+	case <-r.Context().Done():
+		return nil, fmt.Errorf("client disconnected")
+	}
+}
+
+// pipe relays bytes between the public connection and the agent stream until
+// either side closes or the tunnel is shut down.
+func pipe(tunnel *Tunnel, conn io.WriteCloser, connReader io.Reader, stream io.ReadWriteCloser) {
+	closeBoth := sync.OnceFunc(func() {
+		conn.Close()
+		stream.Close()
+	})
+
+	finished := make(chan struct{})
+	go func() {
+		select {
+		case <-tunnel.done:
+			closeBoth()
+		case <-finished:
+		}
+	}()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		io.Copy(&activityWriter{w: stream, touch: tunnel.touch, bytes: tunnel.bytesIn}, connReader)
+		closeBoth()
+	}()
+	go func() {
+		defer wg.Done()
+		io.Copy(&activityWriter{w: conn, touch: tunnel.touch, bytes: tunnel.bytesOut}, stream)
+		closeBoth()
+	}()
+	wg.Wait()
+	close(finished)
+}
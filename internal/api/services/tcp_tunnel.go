@@ -0,0 +1,134 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/config"
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/logger"
+)
+
+// rawKey marks queued connections of tcp tunnels, whose stream carries raw
+// bytes instead of HTTP.
+type rawKey struct{}
+
+func isRawRequest(r *http.Request) bool {
+	raw, _ := r.Context().Value(rawKey{}).(bool)
+	return raw
+}
+
+// allocatePort binds the first free port of a range, starting at a random
+// offset so released ports are not immediately handed out again. A preferred
+// port inside the range is tried first.
+func allocatePort(kind string, preferred, min, max int, bind func(addr string) error) (int, error) {
+	if min <= 0 || max < min {
+		return 0, fmt.Errorf("%s tunnels are not configured", kind)
+	}
+
+	if preferred >= min && preferred <= max {
+		if err := bind(":" + strconv.Itoa(preferred)); err == nil {
+			return preferred, nil
+		}
+	}
+
+	size := max - min + 1
+	offset := rand.Intn(size)
+	for i := 0; i < size; i++ {
+		port := min + (offset+i)%size
+		if err := bind(":" + strconv.Itoa(port)); err == nil {
+			return port, nil
+		}
+	}
+
+	return 0, fmt.Errorf("no %s port available", kind)
+}
+
+func listenTCP(preferred int) (net.Listener, int, error) {
+	var listener net.Listener
+	port, err := allocatePort("tcp", preferred, config.AppConfig.TCP_PORT_MIN, config.AppConfig.TCP_PORT_MAX, func(addr string) error {
+		var err error
+		listener, err = net.Listen("tcp", addr)
+		return err
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return listener, port, nil
+}
+
+func (s *TunnelService) acceptTCP(name string, tunnel *Tunnel) {
+	for {
+		conn, err := tunnel.listener.Accept()
+		if err != nil {
+			return
+		}
+		if !tunnel.access.permits(conn.RemoteAddr().String()) {
+			conn.Close()
+			continue
+		}
+		go s.relayTCP(name, tunnel, conn)
+	}
+}
+
+// relayTCP announces a public connection to the agent as a CONNECT request
+// and pipes it through the stream the agent opens for its token.
+func (s *TunnelService) relayTCP(name string, tunnel *Tunnel, conn net.Conn) {
+	defer conn.Close()
+
+	token := uuid.New().String()
+	streamCh := make(chan io.ReadWriteCloser, 1)
+
+	tunnel.mu.Lock()
+	if tunnel.closed {
+		tunnel.mu.Unlock()
+		return
+	}
+	tunnel.pendingStreams[token] = streamCh
+	requestCh := tunnel.requestCh
+	if tunnel.resetTimer != nil {
+		tunnel.resetTimer()
+	}
+	tunnel.mu.Unlock()
+	defer tunnel.forgetStream(token, streamCh)
+
+	ctx := context.WithValue(context.Background(), rawKey{}, true)
+	req, err := http.NewRequestWithContext(ctx, http.MethodConnect, "/", nil)
+	if err != nil {
+		return
+	}
+	req.Host = conn.LocalAddr().String()
+	req.RemoteAddr = conn.RemoteAddr().String()
+	req.Header.Set("Tunnerse-Request-Token", token)
+	req.Header.Set("Tunnerse-Remote-Addr", conn.RemoteAddr().String())
+
+	timeout := time.Duration(config.AppConfig.TUNNEL_REQUEST_TIMEOUT) * time.Second
+
+	select {
+	case requestCh <- req:
+	case <-time.After(timeout):
+		logger.Log("DEBUG", "TCP connection not picked up by agent", []logger.LogDetail{{Key: "tunnel", Value: name}})
+		return
+	case <-tunnel.done:
+		return
+	}
+
+	stream, err := waitStream(streamCh, timeout, req)
+	if err != nil {
+		return
+	}
+	defer stream.Close()
+
+	logger.Log("DEBUG", "TCP stream established", []logger.LogDetail{
+		{Key: "tunnel", Value: name},
+		{Key: "remote", Value: conn.RemoteAddr().String()},
+	})
+
+	pipe(tunnel, conn, conn, stream)
+}
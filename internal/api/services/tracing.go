@@ -0,0 +1,104 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/models"
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/tracing"
+)
+
+// relayTrace holds the spans of one relayed request: the public receipt,
+// the wait on requestCh and the round trip through the agent, whose context
+// is the one the local app receives.
+type relayTrace struct {
+	ctx    context.Context // Contexto do span público
+	public trace.Span
+	queue  trace.Span
+	agent  trace.Span // Aberto no inject
+}
+
+// startRelayTrace returns nil when tracing is off, leaving the trace headers
+// of the client untouched.
+func startRelayTrace(name, clientIP string, r *http.Request) *relayTrace {
+	if !tracing.Enabled() {
+		return nil
+	}
+
+	tracer := tracing.Tracer()
+	ctx, public := tracer.Start(tracing.Extract(context.Background(), r.Header), "tunnel "+r.Method,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("tunnerse.tunnel", name),
+			attribute.String("http.request.method", r.Method),
+			attribute.String("url.path", r.URL.Path),
+			attribute.String("server.address", r.Host),
+			attribute.String("client.address", clientIP),
+		),
+	)
+	_, queue := tracer.Start(ctx, "tunnel queue", trace.WithSpanKind(trace.SpanKindInternal))
+	return &relayTrace{ctx: ctx, public: public, queue: queue}
+}
+
+// inject opens the agent span and hands its context to the local app. The
+// span starts here, when the request is handed over, so it also covers the
+// wait for the agent.
+func (t *relayTrace) inject(h http.Header) {
+	if t == nil {
+		return
+	}
+	var ctx context.Context
+	ctx, t.agent = tracing.Tracer().Start(t.ctx, "tunnel agent", trace.WithSpanKind(trace.SpanKindClient))
+	tracing.Inject(ctx, h)
+}
+
+func (t *relayTrace) traceID() string {
+	if t == nil {
+		return ""
+	}
+	return t.public.SpanContext().TraceID().String()
+}
+
+// finish closes the spans from the final record. The agent span is only
+// exported when the agent took the request; a span never ended is dropped.
+func (t *relayTrace) finish(record *models.RequestRecord, queuedAt time.Time) {
+	if t == nil {
+		return
+	}
+	end := trace.WithTimestamp(record.StartedAt.Add(record.Latency))
+
+	t.public.SetAttributes(attribute.String("tunnerse.token", record.Token))
+	if record.Status != 0 {
+		t.public.SetAttributes(attribute.Int("http.response.status_code", record.Status))
+	}
+	if record.Replay {
+		t.public.SetAttributes(attribute.Bool("tunnerse.replay", true))
+	}
+	if record.Error != "" || record.Status >= 500 {
+		message := record.Error
+		if message == "" {
+			message = http.StatusText(record.Status)
+		}
+		t.public.SetStatus(codes.Error, message)
+	}
+
+	if queuedAt.IsZero() {
+		t.queue.SetStatus(codes.Error, record.Error)
+		t.queue.End(end)
+	} else {
+		t.queue.End(trace.WithTimestamp(queuedAt))
+
+		if t.agent != nil {
+			if record.Error != "" {
+				t.agent.SetStatus(codes.Error, record.Error)
+			}
+			t.agent.End(end)
+		}
+	}
+	t.public.End(end)
+}
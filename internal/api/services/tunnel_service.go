@@ -1,11 +1,15 @@
 package services
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -14,44 +18,192 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+
 	"github.com/pedroborgesdev/tunnerse-api/internal/api/config"
 	"github.com/pedroborgesdev/tunnerse-api/internal/api/logger"
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/metrics"
 	"github.com/pedroborgesdev/tunnerse-api/internal/api/models"
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/repositories"
 	"github.com/pedroborgesdev/tunnerse-api/internal/api/utils"
 	"github.com/pedroborgesdev/tunnerse-api/internal/api/validation"
 )
 
 type TunnelService struct {
-	validator *validation.TunnelValidator
-	tunnels   map[string]*Tunnel
-	mux       sync.RWMutex
+	validator  *validation.TunnelValidator
+	apiKeys    repositories.APIKeyRepository
+	records    repositories.TunnelRepository  // Registros que sobrevivem a reinícios
+	history    repositories.HistoryRepository // Histórico persistido, opcional
+	tunnels    map[string]*Tunnel
+	mux        sync.RWMutex
+	registerMu sync.Mutex // Serializa registros para respeitar os limites por api key
 }
 
-func NewTunnelService() *TunnelService {
+func NewTunnelService(apiKeys repositories.APIKeyRepository, records repositories.TunnelRepository, history repositories.HistoryRepository) *TunnelService {
 	return &TunnelService{
 		validator: validation.NewTunnelValidator(),
+		apiKeys:   apiKeys,
+		records:   records,
+		history:   history,
 		tunnels:   make(map[string]*Tunnel),
 	}
 }
 
 type Tunnel struct {
+	name            string
 	requestCh       chan *http.Request
 	writerCh        chan http.ResponseWriter
 	pendingRequests map[string]chan *ResponseWithToken // Token -> canal de resposta
+	pendingStreams  map[string]chan io.ReadWriteCloser // Token -> canal do stream do agente
+	options         models.TunnelOptions
+	owner           string       // Nome da api key que registrou o túnel
+	secretHash      []byte       // Hash do segredo exigido nos endpoints do agente
+	access          *accessList  // Redes liberadas e bloqueadas no túnel
+	listener        net.Listener // Porta pública dos túneis tcp
+	udp             *udpRelay    // Porta pública e sessões dos túneis udp
+	muxConns        []*muxConn   // Conexões persistentes do agente
+	history         *historyRing // Trocas recentes, nil quando desativado
 	resetTimer      func()
 	stopTimer       chan struct{}
+	done            chan struct{}
 	closed          bool
 	mu              sync.Mutex
+
+	// Séries resolvidas uma vez no start, que deixam de ser exportadas quando o túnel fecha
+	pending  prometheus.Gauge
+	bytesIn  prometheus.Counter
+	bytesOut prometheus.Counter
+}
+
+// forgetStream drops a pending stream, closing it if the agent attached it
+// after the public side gave up waiting.
+func (t *Tunnel) forgetStream(token string, streamCh chan io.ReadWriteCloser) {
+	t.mu.Lock()
+	delete(t.pendingStreams, token)
+	t.mu.Unlock()
+
+	select {
+	case stream := <-streamCh:
+		if stream != nil {
+			stream.Close()
+		}
+	default:
+	}
+}
+
+// deliverStream hands stream to the request waiting on token. Lookup, claim
+// and send happen under t.mu, so forgetStream either still finds the entry or
+// drains the stream from the channel; when the entry is already gone the
+// stream is closed here instead of leaking.
+func (t *Tunnel) deliverStream(token string, stream io.ReadWriteCloser) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		stream.Close()
+		return fmt.Errorf("tunnel is closed")
+	}
+	streamCh, exists := t.pendingStreams[token]
+	if !exists {
+		stream.Close()
+		return fmt.Errorf("no pending stream found for token: %s (expired or invalid)", token)
+	}
+	delete(t.pendingStreams, token)
+
+	// o canal tem buffer de 1 e só recebe este envio
+	streamCh <- stream
+	return nil
+}
+
+// touch resets the inactivity timer, keeping the tunnel alive while traffic flows.
+func (t *Tunnel) touch() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.closed && t.resetTimer != nil {
+		t.resetTimer()
+	}
 }
 
 type ResponseWithToken struct {
 	Writer http.ResponseWriter
 	Resp   *models.ResponseData
+	Err    error // Falha antes da resposta, como a queda da conexão do agente
+}
+
+// Authenticate resolves the api key presented on register. A nil key with a
+// nil error means the request is anonymous and keys are not required.
+func (s *TunnelService) Authenticate(ctx context.Context, key string) (*models.APIKey, error) {
+	if key == "" {
+		if config.AppConfig.API_KEY_REQUIRED {
+			return nil, validation.ErrAPIKeyRequired
+		}
+		return nil, nil
+	}
+	if s.apiKeys == nil {
+		return nil, validation.ErrAPIKeyInvalid
+	}
+
+	apiKey, err := s.apiKeys.FindByKey(ctx, key)
+	if errors.Is(err, repositories.ErrAPIKeyNotFound) {
+		return nil, validation.ErrAPIKeyInvalid
+	}
+	if err != nil {
+		logger.Log("ERROR", "Failed to look up api key", []logger.LogDetail{{Key: "Error", Value: err.Error()}})
+		return nil, validation.ErrAPIKeyInvalid
+	}
+	if apiKey.Disabled {
+		return nil, validation.ErrAPIKeyInvalid
+	}
+	return apiKey, nil
+}
+
+func (s *TunnelService) ownedTunnels(owner string) int {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
+	count := 0
+	for _, t := range s.tunnels {
+		if t.owner == owner {
+			count++
+		}
+	}
+	return count
 }
 
-func (s *TunnelService) Register(name string) (string, error) {
+func (s *TunnelService) Register(name string, options models.TunnelOptions, apiKey *models.APIKey) (*models.Tunnel, error) {
 	if err := s.validator.ValidateTunnelRegister(name); err != nil {
-		return "", err
+		return nil, err
+	}
+	if options.Type == "" {
+		options.Type = models.TunnelTypeHTTP
+	}
+	if err := s.validator.ValidatePublicAuth(options.Type, options.Auth); err != nil {
+		return nil, err
+	}
+	if _, err := newAccessList(options.Allow, options.Deny); err != nil {
+		return nil, err
+	}
+
+	lifetime := config.AppConfig.TUNNEL_LIFE_TIME
+	owner := ""
+	if apiKey != nil {
+		if err := s.validator.ValidateAllowedPrefix(name, apiKey.AllowedPrefixes); err != nil {
+			return nil, err
+		}
+		if apiKey.MaxLifetime > 0 {
+			lifetime = apiKey.MaxLifetime
+		}
+		owner = apiKey.Name
+	}
+	if err := s.checkReservedName(name, apiKey); err != nil {
+		return nil, err
+	}
+
+	s.registerMu.Lock()
+	defer s.registerMu.Unlock()
+
+	if apiKey != nil && apiKey.MaxTunnels > 0 && s.ownedTunnels(owner) >= apiKey.MaxTunnels {
+		return nil, validation.ErrTunnelLimit
 	}
 
 	var tunnelName string
@@ -68,21 +220,160 @@ func (s *TunnelService) Register(name string) (string, error) {
 		}
 	}
 
+	secret, err := utils.NewSecret(32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate tunnel secret: %w", err)
+	}
+
+	record := &models.Tunnel{
+		Name:       tunnelName,
+		CreatedAt:  time.Now(),
+		Options:    options,
+		Owner:      owner,
+		SecretHash: utils.HashSecret(secret),
+		Secret:     secret,
+	}
+	if lifetime > 0 {
+		expiresAt := record.CreatedAt.Add(time.Duration(lifetime) * time.Second)
+		record.ExpiresAt = &expiresAt
+	}
+
+	if err := s.start(record); err != nil {
+		return nil, err
+	}
+	metrics.Registrations.WithLabelValues(string(record.Options.Type)).Inc()
+
+	if s.records != nil {
+		if err := s.records.Save(context.Background(), record); err != nil {
+			s.Close(tunnelName)
+			return nil, fmt.Errorf("failed to save tunnel: %w", err)
+		}
+	}
+
+	return record, nil
+}
+
+// checkReservedName refuses names reserved by an api key other than the one
+// registering.
+func (s *TunnelService) checkReservedName(name string, apiKey *models.APIKey) error {
+	if s.apiKeys == nil {
+		return nil
+	}
+
+	holder, err := s.apiKeys.FindByReservedName(context.Background(), name)
+	if errors.Is(err, repositories.ErrAPIKeyNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check reserved name: %w", err)
+	}
+	if apiKey == nil || apiKey.KeyHash != holder.KeyHash {
+		return validation.ErrNameNotAllowed
+	}
+	return nil
+}
+
+// Restore brings back the tunnels saved before a restart, so agents can keep
+// using their names and secrets. Expired records are dropped.
+func (s *TunnelService) Restore(ctx context.Context) error {
+	if s.records == nil {
+		return nil
+	}
+
+	records, err := s.records.FindAll(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load tunnels: %w", err)
+	}
+
+	restored := 0
+	for _, record := range records {
+		if record.ExpiresAt != nil && time.Now().After(*record.ExpiresAt) {
+			s.records.Delete(ctx, record.Name)
+			continue
+		}
+
+		port := record.Port
+		if err := s.start(record); err != nil {
+			logger.Log("ERROR", "Failed to restore tunnel", []logger.LogDetail{
+				{Key: "tunnel", Value: record.Name},
+				{Key: "Error", Value: err.Error()},
+			})
+			s.records.Delete(ctx, record.Name)
+			continue
+		}
+
+		// A porta antiga pode ter sido ocupada enquanto o servidor estava fora
+		if record.Port != port {
+			if err := s.records.Save(ctx, record); err != nil {
+				logger.Log("ERROR", "Failed to update restored tunnel", []logger.LogDetail{
+					{Key: "tunnel", Value: record.Name},
+					{Key: "Error", Value: err.Error()},
+				})
+			}
+		}
+		restored++
+	}
+
+	logger.Log("INFO", "Tunnels have been restored", []logger.LogDetail{
+		{Key: "restored", Value: restored},
+		{Key: "saved", Value: len(records)},
+	})
+	return nil
+}
+
+// start creates the runtime state of a tunnel record: public listeners,
+// timers and the cleanup that runs when the tunnel closes.
+func (s *TunnelService) start(record *models.Tunnel) error {
+	access, err := newAccessList(record.Options.Allow, record.Options.Deny)
+	if err != nil {
+		return err
+	}
+
 	t := &Tunnel{
+		name:            record.Name,
 		requestCh:       make(chan *http.Request),
 		writerCh:        make(chan http.ResponseWriter),
 		pendingRequests: make(map[string]chan *ResponseWithToken),
-		stopTimer:       make(chan struct{}),
+		pendingStreams:  make(map[string]chan io.ReadWriteCloser),
+		options:         record.Options,
+		owner:           record.Owner,
+		secretHash:      record.SecretHash,
+		access:          access,
+		history:         newHistoryRing(config.AppConfig.HISTORY_SIZE),
+		stopTimer:       make(chan struct{}, 1), // Close não pode perder o sinal antes do select
+		done:            make(chan struct{}),
+		pending:         metrics.PendingRequests.WithLabelValues(record.Name),
+		bytesIn:         metrics.BytesIn.WithLabelValues(record.Name),
+		bytesOut:        metrics.BytesOut.WithLabelValues(record.Name),
+	}
+
+	if record.Options.Type == models.TunnelTypeTCP {
+		listener, port, err := listenTCP(record.Port)
+		if err != nil {
+			return err
+		}
+		t.listener = listener
+		record.Port = port
+	}
+
+	if record.Options.Type == models.TunnelTypeUDP {
+		relay, port, err := listenUDP(record.Port)
+		if err != nil {
+			return err
+		}
+		t.udp = relay
+		record.Port = port
 	}
 
+	tunnelName := record.Name
+
 	inactivityDuration := time.Duration(config.AppConfig.TUNNEL_INACTIVITY_LIFE_TIME) * time.Second
 	inactivityTimer := time.NewTimer(inactivityDuration)
 
 	var maxLifetimeTimer *time.Timer
-	maxLifetimeDuration := time.Duration(config.AppConfig.TUNNEL_LIFE_TIME) * time.Second
-	hasMaxLifetime := config.AppConfig.TUNNEL_LIFE_TIME > 0
+	hasMaxLifetime := record.ExpiresAt != nil
 	if hasMaxLifetime {
-		maxLifetimeTimer = time.NewTimer(maxLifetimeDuration)
+		maxLifetimeTimer = time.NewTimer(time.Until(*record.ExpiresAt))
 	}
 
 	t.resetTimer = func() {
@@ -95,9 +386,19 @@ func (s *TunnelService) Register(name string) (string, error) {
 		inactivityTimer.Reset(inactivityDuration)
 	}
 
+	s.loadHistory(tunnelName, t)
+
 	s.mux.Lock()
 	s.tunnels[tunnelName] = t
 	s.mux.Unlock()
+	metrics.TunnelsActive.WithLabelValues(string(record.Options.Type)).Inc()
+
+	if t.listener != nil {
+		go s.acceptTCP(tunnelName, t)
+	}
+	if t.udp != nil {
+		go s.serveUDP(tunnelName, t)
+	}
 
 	go func(tunnelName string, t *Tunnel) {
 		defer func() {
@@ -113,6 +414,10 @@ func (s *TunnelService) Register(name string) (string, error) {
 				close(ch)
 				delete(t.pendingRequests, token)
 			}
+			for token, ch := range t.pendingStreams {
+				close(ch)
+				delete(t.pendingStreams, token)
+			}
 			t.mu.Unlock()
 
 			s.mux.Lock()
@@ -122,6 +427,35 @@ func (s *TunnelService) Register(name string) (string, error) {
 			close(t.requestCh)
 			close(t.writerCh)
 			close(t.stopTimer)
+			close(t.done)
+
+			metrics.TunnelsActive.WithLabelValues(string(t.options.Type)).Dec()
+			metrics.ForgetTunnel(tunnelName)
+
+			if t.listener != nil {
+				t.listener.Close()
+			}
+			if t.udp != nil {
+				t.udp.conn.Close()
+			}
+
+			if s.history != nil {
+				if err := s.history.DeleteTunnel(context.Background(), tunnelName); err != nil {
+					logger.Log("ERROR", "Failed to delete request history", []logger.LogDetail{
+						{Key: "tunnel", Value: tunnelName},
+						{Key: "Error", Value: err.Error()},
+					})
+				}
+			}
+
+			if s.records != nil {
+				if err := s.records.Delete(context.Background(), tunnelName); err != nil && !errors.Is(err, repositories.ErrTunnelNotFound) {
+					logger.Log("ERROR", "Failed to delete tunnel record", []logger.LogDetail{
+						{Key: "tunnel", Value: tunnelName},
+						{Key: "Error", Value: err.Error()},
+					})
+				}
+			}
 		}()
 
 		if hasMaxLifetime {
@@ -138,10 +472,40 @@ func (s *TunnelService) Register(name string) (string, error) {
 		}
 	}(tunnelName, t)
 
-	return tunnelName, nil
+	return nil
+}
+
+// Authorize checks the secret presented by an agent against the one issued
+// when the tunnel was registered.
+func (s *TunnelService) Authorize(name, secret string) error {
+	s.mux.RLock()
+	tunnel, exists := s.tunnels[name]
+	s.mux.RUnlock()
+	if !exists {
+		return fmt.Errorf("tunnel not found")
+	}
+
+	if !utils.MatchSecret(secret, tunnel.secretHash) {
+		return fmt.Errorf("invalid tunnel secret")
+	}
+	return nil
 }
 
 func (s *TunnelService) Get(name string, r *http.Request) ([]byte, error) {
+	sreq, err := s.Next(r.Context(), name)
+	if err != nil {
+		if r.Context().Err() != nil {
+			return nil, fmt.Errorf("client disconnected; tunnel has a 1-minute grace period")
+		}
+		return nil, err
+	}
+
+	return json.Marshal(sreq)
+}
+
+// Next waits for the next public request queued on the tunnel, as seen by
+// the agent.
+func (s *TunnelService) Next(ctx context.Context, name string) (*models.SerializableRequest, error) {
 	s.mux.RLock()
 	tunnel, exists := s.tunnels[name]
 	s.mux.RUnlock()
@@ -167,10 +531,16 @@ func (s *TunnelService) Get(name string, r *http.Request) ([]byte, error) {
 		if req == nil {
 			return nil, fmt.Errorf("nil request received")
 		}
-	case <-r.Context().Done():
-		return nil, fmt.Errorf("client disconnected; tunnel has a 1-minute grace period")
+	case <-ctx.Done():
+		return nil, ctx.Err()
 	}
 
+	return serializeRequest(req)
+}
+
+// serializeRequest converts a queued public request into the JSON shape
+// delivered to agents, carrying its Tunnerse-Request-Token.
+func serializeRequest(req *http.Request) (*models.SerializableRequest, error) {
 	// Extrai o token da requisição recebida
 	token := req.Header.Get("Tunnerse-Request-Token")
 	if token == "" {
@@ -180,8 +550,11 @@ func (s *TunnelService) Get(name string, r *http.Request) ([]byte, error) {
 		}
 	}
 
+	// Em modo stream o body é lido pelo agente através de /_tunnerse/stream
+	streaming := isStreamRequest(req)
+
 	var bodyBytes []byte
-	if req.Body != nil {
+	if req.Body != nil && !streaming {
 		defer req.Body.Close()
 		var err error
 		bodyBytes, err = io.ReadAll(req.Body)
@@ -197,16 +570,31 @@ func (s *TunnelService) Get(name string, r *http.Request) ([]byte, error) {
 		headersCopy[k] = copied
 	}
 
-	sreq := models.SerializableRequest{
-		Method: req.Method,
-		Path:   req.URL.String(),
-		Header: headersCopy,
-		Body:   string(bodyBytes),
-		Host:   req.Host,
-		Token:  token, // Inclui o token na resposta
+	sreq := &models.SerializableRequest{
+		Method:  req.Method,
+		Path:    req.URL.String(),
+		Header:  headersCopy,
+		Body:    string(bodyBytes),
+		Host:    req.Host,
+		Token:   token, // Inclui o token na resposta
+		Remote:  req.RemoteAddr,
+		Upgrade: isUpgradeRequest(req),
+		Stream:  streaming && !isUpgradeRequest(req) && !isRawRequest(req),
+		TCP:     isRawRequest(req),
 	}
 
-	return json.Marshal(&sreq)
+	return sreq, nil
+}
+
+// clientAddr returns the address of the public client: clientIP, as resolved
+// through the trusted proxies, with the port of the connection that reached
+// the server.
+func clientAddr(clientIP, remoteAddr string) string {
+	_, port, err := net.SplitHostPort(remoteAddr)
+	if err != nil || clientIP == "" {
+		return remoteAddr
+	}
+	return net.JoinHostPort(clientIP, port)
 }
 
 func (s *TunnelService) Response(name string, body io.ReadCloser) error {
@@ -224,6 +612,11 @@ func (s *TunnelService) Response(name string, body io.ReadCloser) error {
 		return fmt.Errorf("failed to decode response JSON: %w", err)
 	}
 
+	return s.deliver(name, tunnel, &resp)
+}
+
+// deliver hands an agent response to the public request waiting on its token.
+func (s *TunnelService) deliver(name string, tunnel *Tunnel, resp *models.ResponseData) error {
 	// Log all response headers for debugging
 	logger.Log("DEBUG", "Response headers received", []logger.LogDetail{
 		{Key: "tunnel", Value: name},
@@ -253,7 +646,7 @@ func (s *TunnelService) Response(name string, body io.ReadCloser) error {
 
 	// Envia a resposta para o canal específico desta requisição
 	select {
-	case responseCh <- &ResponseWithToken{Resp: &resp}:
+	case responseCh <- &ResponseWithToken{Resp: resp}:
 		close(responseCh)
 	case <-time.After(5 * time.Second):
 		close(responseCh)
@@ -263,7 +656,7 @@ func (s *TunnelService) Response(name string, body io.ReadCloser) error {
 	return nil
 }
 
-func (s *TunnelService) Tunnel(name, path string, w http.ResponseWriter, r *http.Request) error {
+func (s *TunnelService) Tunnel(name, path, clientIP string, w http.ResponseWriter, r *http.Request) error {
 	if err := s.validator.ValidateTunnelRegister(name); err != nil {
 		return err
 	}
@@ -275,6 +668,29 @@ func (s *TunnelService) Tunnel(name, path string, w http.ResponseWriter, r *http
 		return fmt.Errorf("tunnel not found")
 	}
 
+	// Túneis tcp e udp só recebem tráfego pela porta alocada
+	if tunnel.options.Type != models.TunnelTypeHTTP {
+		return fmt.Errorf("tunnel not found")
+	}
+
+	if !tunnel.access.permits(clientIP) {
+		return fmt.Errorf("forbidden")
+	}
+
+	cookiePath := "/"
+	if !config.AppConfig.SUBDOMAIN {
+		cookiePath = "/" + name
+	}
+	if !authorizePublic(tunnel.options.Auth, w, r, cookiePath) {
+		return fmt.Errorf("unauthorized")
+	}
+
+	return s.relay(name, path, clientIP, tunnel, w, r, &models.RequestRecord{})
+}
+
+// relay queues a public request for the agent and writes back its answer,
+// filling record with the exchange and keeping it in the tunnel history.
+func (s *TunnelService) relay(name, path, clientIP string, tunnel *Tunnel, w http.ResponseWriter, r *http.Request, record *models.RequestRecord) (err error) {
 	tunnel.mu.Lock()
 	if tunnel.closed {
 		tunnel.mu.Unlock()
@@ -298,30 +714,80 @@ func (s *TunnelService) Tunnel(name, path string, w http.ResponseWriter, r *http
 	}
 	tunnel.pendingRequests[token] = responseCh
 	tunnel.mu.Unlock()
+	tunnel.pending.Inc()
 
 	// Cleanup: remove o canal se a resposta não chegar
 	defer func() {
 		tunnel.mu.Lock()
 		delete(tunnel.pendingRequests, token)
 		tunnel.mu.Unlock()
+		tunnel.pending.Dec()
 	}()
 
-	var bodyBytes []byte
-	if r.Body != nil {
-		defer r.Body.Close()
-		var err error
-		bodyBytes, err = io.ReadAll(r.Body)
+	upgrade := isUpgradeRequest(r)
+	streaming := upgrade || tunnel.options.Stream
+
+	record.ID = uuid.New().String()
+	record.Tunnel = name
+	record.Token = token
+	record.StartedAt = time.Now()
+	record.Method = r.Method
+	record.Host = r.Host
+	record.ClientIP = clientIP
+	requestPreview := newPreviewBuffer()
+	responsePreview := newPreviewBuffer()
+	var queuedAt time.Time
+
+	trace := startRelayTrace(name, clientIP, r)
+	record.TraceID = trace.traceID()
+
+	defer func() {
+		record.Latency = time.Since(record.StartedAt)
+		if !queuedAt.IsZero() {
+			record.QueueTime = queuedAt.Sub(record.StartedAt)
+			record.WaitTime = time.Since(queuedAt)
+		}
+		record.Body, record.BodySize, record.BodyTruncated = requestPreview.result()
+		record.ResponseBody, record.ResponseBodySize, record.ResponseBodyTruncated = responsePreview.result()
 		if err != nil {
-			return fmt.Errorf("failed to read request body: %w", err)
+			record.Error = err.Error()
+		}
+		trace.finish(record, queuedAt)
+		s.saveRecord(tunnel, record)
+		tunnel.observe(record, !queuedAt.IsZero())
+		logRecord(record)
+	}()
+
+	var clonedRequest *http.Request
+	if streaming {
+		// O body segue sem buffer até o agente abrir o stream
+		clonedRequest = r.Clone(context.WithValue(r.Context(), streamKey{}, true))
+		if clonedRequest.Body != nil && clonedRequest.Body != http.NoBody {
+			clonedRequest.Body = &teeReadCloser{Reader: io.TeeReader(clonedRequest.Body, requestPreview), Closer: clonedRequest.Body}
 		}
+	} else {
+		var bodyBytes []byte
+		if r.Body != nil {
+			defer r.Body.Close()
+			var err error
+			bodyBytes, err = io.ReadAll(r.Body)
+			if err != nil {
+				return fmt.Errorf("failed to read request body: %w", err)
+			}
+		}
+
+		r.Body = io.NopCloser(bytes.NewReader(bodyBytes))
+		clonedRequest = r.Clone(r.Context())
+		clonedRequest.Body = io.NopCloser(bytes.NewReader(bodyBytes))
+		requestPreview.Write(bodyBytes)
 	}
 
-	r.Body = io.NopCloser(bytes.NewReader(bodyBytes))
-	clonedRequest := r.Clone(r.Context())
-	clonedRequest.Body = io.NopCloser(bytes.NewReader(bodyBytes))
+	// As credenciais do túnel nunca chegam à aplicação local
+	stripPublicCredentials(tunnel.options.Auth, clonedRequest)
 
 	// Adiciona o token ao header da requisição
 	clonedRequest.Header.Set("Tunnerse-Request-Token", token)
+	clonedRequest.RemoteAddr = clientAddr(clientIP, r.RemoteAddr)
 
 	if !config.AppConfig.SUBDOMAIN {
 		if parts := strings.SplitN(clonedRequest.URL.Path, "/", 3); len(parts) >= 3 {
@@ -336,28 +802,57 @@ func (s *TunnelService) Tunnel(name, path string, w http.ResponseWriter, r *http
 		clonedRequest.RequestURI = path
 	}
 
+	record.Path = clonedRequest.URL.RequestURI()
+	record.Header = clonedRequest.Header.Clone()
+	record.Header.Del("Tunnerse-Request-Token")
+
+	// Depois do histórico, para que um replay não herde o span desta requisição
+	trace.inject(clonedRequest.Header)
+
 	timeout := time.Duration(config.AppConfig.TUNNEL_REQUEST_TIMEOUT) * time.Second
 
+	var streamCh chan io.ReadWriteCloser
+
 	tunnel.mu.Lock()
 	if tunnel.closed {
 		tunnel.mu.Unlock()
 		return fmt.Errorf("tunnel is closed")
 	}
 	requestCh := tunnel.requestCh
+	if streaming {
+		streamCh = make(chan io.ReadWriteCloser, 1)
+		tunnel.pendingStreams[token] = streamCh
+	}
 	tunnel.mu.Unlock()
 
+	if streaming {
+		defer tunnel.forgetStream(token, streamCh)
+	}
+
 	// Envia a requisição
 	select {
 	case requestCh <- clonedRequest:
+		queuedAt = time.Now()
 	case <-time.After(timeout):
 		return fmt.Errorf("timeout")
 	case <-r.Context().Done():
 		return fmt.Errorf("client disconnected")
 	}
 
+	if upgrade {
+		record.Status = http.StatusSwitchingProtocols
+		return s.relayUpgrade(name, tunnel, clonedRequest, streamCh, timeout, w, r)
+	}
+	if streaming {
+		return s.relayStream(name, tunnel, clonedRequest, streamCh, timeout, w, r, record, responsePreview)
+	}
+
 	// Aguarda a resposta específica para este token
 	select {
 	case respData := <-responseCh:
+		if respData != nil && respData.Err != nil {
+			return respData.Err
+		}
 		if respData == nil || respData.Resp == nil {
 			return fmt.Errorf("received nil response")
 		}
@@ -382,6 +877,10 @@ func (s *TunnelService) Tunnel(name, path string, w http.ResponseWriter, r *http
 			}
 		}
 
+		record.Status = respData.Resp.StatusCode
+		record.ResponseHeader = http.Header(respData.Resp.Headers).Clone()
+		responsePreview.Write(bodyDecoded)
+
 		// Escreve o status code e body
 		w.WriteHeader(respData.Resp.StatusCode)
 		_, err = w.Write(bodyDecoded)
@@ -394,6 +893,117 @@ func (s *TunnelService) Tunnel(name, path string, w http.ResponseWriter, r *http
 	}
 }
 
+// Stream attaches the agent connection carried by r to the pending upgrade
+// identified by token. The connection is upgraded to a WebSocket whose binary
+// messages carry the stream and, from then on, is owned by the relay started
+// in Tunnel.
+func (s *TunnelService) Stream(name, token string, w http.ResponseWriter, r *http.Request) error {
+	s.mux.RLock()
+	tunnel, exists := s.tunnels[name]
+	s.mux.RUnlock()
+	if !exists {
+		return fmt.Errorf("tunnel not found")
+	}
+
+	if token == "" {
+		return fmt.Errorf("missing Tunnerse-Request-Token in stream")
+	}
+
+	// Rejeita antes do upgrade; a posse do token só é tomada em deliverStream
+	tunnel.mu.Lock()
+	_, exists = tunnel.pendingStreams[token]
+	closed := tunnel.closed
+	tunnel.mu.Unlock()
+	if closed {
+		return fmt.Errorf("tunnel is closed")
+	}
+	if !exists {
+		return fmt.Errorf("no pending stream found for token: %s (expired or invalid)", token)
+	}
+
+	conn, err := upgradeAgent(w, r)
+	if err != nil {
+		return err
+	}
+
+	// O upgrade já respondeu o agente, então o erro só serve para o log
+	return tunnel.deliverStream(token, newWSStream(conn))
+}
+
+// Attach is the in-process counterpart of Stream, used by frontends that
+// already hold a bidirectional channel to the local app. On error the channel
+// has already been closed.
+func (s *TunnelService) Attach(name, token string, stream io.ReadWriteCloser) error {
+	s.mux.RLock()
+	tunnel, exists := s.tunnels[name]
+	s.mux.RUnlock()
+	if !exists {
+		stream.Close()
+		return fmt.Errorf("tunnel not found")
+	}
+
+	return tunnel.deliverStream(token, stream)
+}
+
+// relayUpgrade waits for the agent to open the stream for an upgrade request,
+// replays the handshake on it and bridges both connections until one side closes.
+func (s *TunnelService) relayUpgrade(name string, tunnel *Tunnel, req *http.Request, streamCh chan io.ReadWriteCloser, timeout time.Duration, w http.ResponseWriter, r *http.Request) error {
+	stream, err := waitStream(streamCh, timeout, r)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		return fmt.Errorf("connection does not support upgrade")
+	}
+	clientConn, clientBuf, err := hijacker.Hijack()
+	if err != nil {
+		return fmt.Errorf("failed to hijack client connection: %w", err)
+	}
+	defer clientConn.Close()
+
+	if err := req.Write(stream); err != nil {
+		logger.Log("ERROR", "Failed to forward upgrade handshake", []logger.LogDetail{
+			{Key: "tunnel", Value: name},
+			{Key: "Error", Value: err.Error()},
+		})
+		return nil
+	}
+
+	logger.Log("DEBUG", "Upgrade stream established", []logger.LogDetail{
+		{Key: "tunnel", Value: name},
+		{Key: "path", Value: req.URL.Path},
+	})
+
+	pipe(tunnel, clientConn, clientBuf.Reader, stream)
+	return nil
+}
+
+func (s *TunnelService) Stats(name string) (*models.TunnelStats, error) {
+	s.mux.RLock()
+	tunnel, exists := s.tunnels[name]
+	s.mux.RUnlock()
+	if !exists {
+		return nil, fmt.Errorf("tunnel not found")
+	}
+
+	stats := &models.TunnelStats{
+		Name: name,
+		Type: tunnel.options.Type,
+	}
+	if tunnel.listener != nil {
+		stats.Port = tunnel.listener.Addr().(*net.TCPAddr).Port
+	}
+	if tunnel.udp != nil {
+		stats.Port = tunnel.udp.conn.LocalAddr().(*net.UDPAddr).Port
+		stats.UDP = tunnel.udp.stats()
+	}
+
+	return stats, nil
+}
+
 func (s *TunnelService) Close(name string) error {
 	s.mux.Lock()
 	tunnel, exists := s.tunnels[name]
@@ -421,6 +1031,69 @@ func (s *TunnelService) Close(name string) error {
 	return nil
 }
 
+// relayStream writes the request as raw HTTP on the agent stream, body
+// included, and copies the local response back as it is produced.
+func (s *TunnelService) relayStream(name string, tunnel *Tunnel, req *http.Request, streamCh chan io.ReadWriteCloser, timeout time.Duration, w http.ResponseWriter, r *http.Request, record *models.RequestRecord, preview io.Writer) error {
+	stream, err := waitStream(streamCh, timeout, r)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	// Uma requisição por stream: a API local deve fechar a conexão no fim
+	req.Close = true
+	go req.Write(&activityWriter{w: stream, touch: tunnel.touch})
+
+	headerTimer := time.AfterFunc(timeout, func() { stream.Close() })
+	resp, err := http.ReadResponse(bufio.NewReader(stream), req)
+	if !headerTimer.Stop() {
+		return fmt.Errorf("timeout")
+	}
+	if err != nil {
+		return fmt.Errorf("local-api-error")
+	}
+	defer resp.Body.Close()
+
+	if resp.Header.Get("Tunnerse") == "local-api-error" {
+		return fmt.Errorf("local-api-error")
+	}
+
+	removeHopHeaders(resp.Header)
+	for key, values := range resp.Header {
+		for _, v := range values {
+			w.Header().Add(key, v)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+
+	record.Status = resp.StatusCode
+	record.ResponseHeader = resp.Header.Clone()
+
+	// Com os headers já enviados, falhas na cópia não podem mais virar uma página de erro
+	client := io.MultiWriter(&activityWriter{w: newFlushWriter(w), touch: tunnel.touch}, preview)
+	if _, err := io.Copy(client, resp.Body); err != nil {
+		logger.Log("DEBUG", "Stream interrupted", []logger.LogDetail{
+			{Key: "tunnel", Value: name},
+			{Key: "Error", Value: err.Error()},
+		})
+	}
+	return nil
+}
+
+func isUpgradeRequest(r *http.Request) bool {
+	if r.Header.Get("Upgrade") == "" {
+		return false
+	}
+	for _, value := range r.Header.Values("Connection") {
+		for _, token := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func (s *TunnelService) serveHTML(w http.ResponseWriter, status int, headerValue, folder, fallbackMsg string) {
 	w.Header().Set("Content-Type", "text/html")
 	w.Header().Set("Tunnerse", headerValue)
@@ -449,6 +1122,14 @@ func (s *TunnelService) LocalError(w http.ResponseWriter) {
 	s.serveHTML(w, http.StatusServiceUnavailable, "local-api-error", "localerror", "503 - local api error")
 }
 
+func (s *TunnelService) Unauthorized(w http.ResponseWriter) {
+	s.serveHTML(w, http.StatusUnauthorized, "tunnel-unauthorized", "unauthorized", "401 - unauthorized")
+}
+
+func (s *TunnelService) Forbidden(w http.ResponseWriter) {
+	s.serveHTML(w, http.StatusForbidden, "tunnel-forbidden", "forbidden", "403 - forbidden")
+}
+
 func (s *TunnelService) Home(w http.ResponseWriter) {
 	s.serveHTML(w, http.StatusOK, "tunnel-working", "running", "Tunnerse is running")
 }
@@ -0,0 +1,185 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/config"
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/models"
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/repositories"
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/validation"
+)
+
+// testAPIKeys writes keys to a temporary file and opens it as a repository.
+func testAPIKeys(t *testing.T, keys string) *repositories.FileAPIKeyRepository {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "keys.json")
+	if err := os.WriteFile(path, []byte(keys), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	repo, err := repositories.NewFileAPIKeyRepository(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return repo
+}
+
+func TestRegisterAPIKeyLimits(t *testing.T) {
+	config.LoadAppConfig()
+	config.AppConfig.TUNNEL_LIFE_TIME = 3600
+
+	apiKeys := testAPIKeys(t, `[
+		{"name": "team", "key": "team-key", "max_tunnels": 2, "allowed_prefixes": ["team", "shared"], "max_lifetime": 60},
+		{"name": "ops", "key": "ops-key", "reserved_names": ["shared"]},
+		{"name": "open", "key": "open-key"}
+	]`)
+
+	tests := []struct {
+		name     string
+		key      string // Vazio registra sem api key
+		tunnel   string
+		existing int // Túneis já abertos pela mesma chave
+		wantErr  error
+		lifetime time.Duration
+	}{
+		{name: "without api key", tunnel: "demo", lifetime: time.Hour},
+		{name: "allowed prefix", key: "team-key", tunnel: "team-api", lifetime: time.Minute},
+		{name: "name outside the prefixes", key: "team-key", tunnel: "other", wantErr: validation.ErrNameNotAllowed},
+		{name: "below the tunnel limit", key: "team-key", tunnel: "team-api", existing: 1, lifetime: time.Minute},
+		{name: "tunnel limit reached", key: "team-key", tunnel: "team-api", existing: 2, wantErr: validation.ErrTunnelLimit},
+		{name: "name reserved by another key", key: "team-key", tunnel: "shared", wantErr: validation.ErrNameNotAllowed},
+		{name: "reserved name without api key", tunnel: "shared", wantErr: validation.ErrNameNotAllowed},
+		{name: "reserved name of the key", key: "ops-key", tunnel: "shared", lifetime: time.Hour},
+		{name: "key without limits", key: "open-key", tunnel: "anything", existing: 5, lifetime: time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := NewTunnelService(apiKeys, repositories.NewMemoryTunnelRepository(), nil)
+			apiKey, err := svc.Authenticate(context.Background(), tt.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i := 0; i < tt.existing; i++ {
+				open, err := svc.Register(tt.tunnel, models.TunnelOptions{}, apiKey)
+				if err != nil {
+					t.Fatalf("existing tunnel %d: %v", i, err)
+				}
+				defer svc.Close(open.Name)
+			}
+
+			tunnel, err := svc.Register(tt.tunnel, models.TunnelOptions{}, apiKey)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Register() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			defer svc.Close(tunnel.Name)
+
+			if apiKey != nil && tunnel.Owner != apiKey.Name {
+				t.Errorf("owner = %q, want %q", tunnel.Owner, apiKey.Name)
+			}
+			if tunnel.ExpiresAt == nil {
+				t.Fatal("tunnel without expiry")
+			}
+			if got := tunnel.ExpiresAt.Sub(tunnel.CreatedAt); got != tt.lifetime {
+				t.Errorf("lifetime = %v, want %v", got, tt.lifetime)
+			}
+		})
+	}
+}
+
+func TestRestore(t *testing.T) {
+	config.LoadAppConfig()
+	config.AppConfig.TCP_PORT_MIN = 42000
+	config.AppConfig.TCP_PORT_MAX = 42099
+	config.AppConfig.UDP_PORT_MIN = 42100
+	config.AppConfig.UDP_PORT_MAX = 42199
+
+	// Outro processo ocupou a porta do túnel tcp enquanto o servidor estava fora
+	busy, err := net.Listen("tcp", ":42000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+
+	ctx := context.Background()
+	past := time.Now().Add(-time.Minute)
+	future := time.Now().Add(time.Hour)
+	records := repositories.NewMemoryTunnelRepository()
+	for _, record := range []*models.Tunnel{
+		{Name: "expired-aaa", ExpiresAt: &past},
+		{Name: "http-bbb", ExpiresAt: &future, SecretHash: []byte("hash")},
+		{Name: "tcp-ccc", Options: models.TunnelOptions{Type: models.TunnelTypeTCP}, Port: 42000},
+		{Name: "udp-ddd", Options: models.TunnelOptions{Type: models.TunnelTypeUDP}, Port: 42150},
+		{Name: "broken-eee", Options: models.TunnelOptions{Allow: []string{"not an ip"}}},
+	} {
+		if err := records.Save(ctx, record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	svc := NewTunnelService(nil, records, nil)
+	if err := svc.Restore(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		for _, name := range []string{"http-bbb", "tcp-ccc", "udp-ddd"} {
+			svc.Close(name)
+		}
+	}()
+
+	for _, name := range []string{"expired-aaa", "broken-eee"} {
+		if _, err := svc.Stats(name); err == nil {
+			t.Errorf("%s was restored", name)
+		}
+	}
+
+	tests := []struct {
+		name string
+		port func(int) bool
+	}{
+		{name: "http-bbb", port: func(port int) bool { return port == 0 }},
+		{name: "tcp-ccc", port: func(port int) bool { return port > 42000 && port <= 42099 }},
+		{name: "udp-ddd", port: func(port int) bool { return port == 42150 }},
+	}
+	for _, tt := range tests {
+		stats, err := svc.Stats(tt.name)
+		if err != nil {
+			t.Errorf("%s was not restored: %v", tt.name, err)
+			continue
+		}
+		if !tt.port(stats.Port) {
+			t.Errorf("%s listens on port %d", tt.name, stats.Port)
+		}
+	}
+
+	// O registro guarda a porta nova e perde o que não pôde voltar
+	saved, err := records.FindAll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ports := map[string]int{}
+	for _, record := range saved {
+		ports[record.Name] = record.Port
+	}
+	if _, ok := ports["broken-eee"]; ok {
+		t.Error("record that failed to start was kept")
+	}
+	if stats, _ := svc.Stats("tcp-ccc"); ports["tcp-ccc"] != stats.Port {
+		t.Errorf("saved tcp port = %d, want the new port %d", ports["tcp-ccc"], stats.Port)
+	}
+	if ports["udp-ddd"] != 42150 {
+		t.Errorf("saved udp port = %d, want 42150", ports["udp-ddd"])
+	}
+	if len(ports) != 3 {
+		t.Errorf("saved records = %v, want the three live tunnels", ports)
+	}
+}
@@ -0,0 +1,211 @@
+package services
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/config"
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/logger"
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/models"
+)
+
+const maxDatagramSize = 64 * 1024
+
+// udpRelay maps every remote peer of a udp tunnel to a session and forwards
+// its datagrams to the agent over the persistent connection.
+type udpRelay struct {
+	conn     net.PacketConn
+	sessions map[string]*udpSession // Endereço remoto -> sessão
+	byID     map[string]*udpSession
+	idle     time.Duration // Inatividade máxima de uma sessão
+	mu       sync.Mutex
+
+	packetsIn  atomic.Uint64
+	bytesIn    atomic.Uint64
+	packetsOut atomic.Uint64
+	bytesOut   atomic.Uint64
+	dropped    atomic.Uint64
+}
+
+type udpSession struct {
+	id       string
+	addr     net.Addr
+	lastSeen time.Time
+}
+
+func listenUDP(preferred int) (*udpRelay, int, error) {
+	var conn net.PacketConn
+	port, err := allocatePort("udp", preferred, config.AppConfig.UDP_PORT_MIN, config.AppConfig.UDP_PORT_MAX, func(addr string) error {
+		var err error
+		conn, err = net.ListenPacket("udp", addr)
+		return err
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	idle := time.Duration(config.AppConfig.UDP_SESSION_TIMEOUT) * time.Second
+	if idle <= 0 {
+		idle = time.Minute
+	}
+
+	return &udpRelay{
+		conn:     conn,
+		idle:     idle,
+		sessions: make(map[string]*udpSession),
+		byID:     make(map[string]*udpSession),
+	}, port, nil
+}
+
+func (u *udpRelay) session(addr net.Addr) *udpSession {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	session, exists := u.sessions[addr.String()]
+	if !exists {
+		session = &udpSession{id: uuid.New().String(), addr: addr}
+		u.sessions[addr.String()] = session
+		u.byID[session.id] = session
+	}
+	session.lastSeen = time.Now()
+	return session
+}
+
+func (u *udpRelay) stats() *models.UDPStats {
+	u.mu.Lock()
+	sessions := len(u.sessions)
+	u.mu.Unlock()
+
+	return &models.UDPStats{
+		Sessions:   sessions,
+		PacketsIn:  u.packetsIn.Load(),
+		BytesIn:    u.bytesIn.Load(),
+		PacketsOut: u.packetsOut.Load(),
+		BytesOut:   u.bytesOut.Load(),
+		Dropped:    u.dropped.Load(),
+	}
+}
+
+func (s *TunnelService) serveUDP(name string, tunnel *Tunnel) {
+	go s.expireUDPSessions(name, tunnel)
+
+	relay := tunnel.udp
+	buf := make([]byte, maxDatagramSize)
+	for {
+		n, addr, err := relay.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		if !tunnel.access.permits(addr.String()) {
+			relay.dropped.Add(1)
+			continue
+		}
+		relay.packetsIn.Add(1)
+		relay.bytesIn.Add(uint64(n))
+		tunnel.bytesIn.Add(float64(n))
+		tunnel.touch()
+
+		session := relay.session(addr)
+
+		conn := tunnel.currentMux()
+		if conn == nil {
+			relay.dropped.Add(1)
+			continue
+		}
+
+		data := make([]byte, n)
+		copy(data, buf[:n])
+		err = conn.send(&models.Frame{
+			Type: models.FrameDatagram,
+			Datagram: &models.Datagram{
+				Session: session.id,
+				Remote:  addr.String(),
+				Data:    data,
+			},
+		})
+		if err != nil {
+			relay.dropped.Add(1)
+		}
+	}
+}
+
+// replyUDP sends a datagram from the agent back to the peer of its session.
+func (s *TunnelService) replyUDP(tunnel *Tunnel, datagram *models.Datagram) error {
+	relay := tunnel.udp
+	if relay == nil {
+		return fmt.Errorf("tunnel does not accept datagrams")
+	}
+
+	relay.mu.Lock()
+	session, exists := relay.byID[datagram.Session]
+	if exists {
+		session.lastSeen = time.Now()
+	}
+	relay.mu.Unlock()
+	if !exists {
+		return fmt.Errorf("no udp session found: %s (expired or invalid)", datagram.Session)
+	}
+
+	n, err := relay.conn.WriteTo(datagram.Data, session.addr)
+	if err != nil {
+		return err
+	}
+	relay.packetsOut.Add(1)
+	relay.bytesOut.Add(uint64(n))
+	tunnel.bytesOut.Add(float64(n))
+	return nil
+}
+
+// expireUDPSessions drops idle sessions and tells the agent to release the
+// local socket it keeps for each of them.
+func (s *TunnelService) expireUDPSessions(name string, tunnel *Tunnel) {
+	relay := tunnel.udp
+	interval := relay.idle / 2
+	if interval < time.Second {
+		interval = time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-tunnel.done:
+			return
+		case <-ticker.C:
+		}
+
+		var expired []string
+		relay.mu.Lock()
+		for key, session := range relay.sessions {
+			if time.Since(session.lastSeen) > relay.idle {
+				expired = append(expired, session.id)
+				delete(relay.sessions, key)
+				delete(relay.byID, session.id)
+			}
+		}
+		relay.mu.Unlock()
+
+		if len(expired) == 0 {
+			continue
+		}
+
+		logger.Log("DEBUG", "UDP sessions expired", []logger.LogDetail{
+			{Key: "tunnel", Value: name},
+			{Key: "sessions", Value: len(expired)},
+		})
+
+		if conn := tunnel.currentMux(); conn != nil {
+			for _, id := range expired {
+				conn.send(&models.Frame{
+					Type:     models.FrameSessionClose,
+					Datagram: &models.Datagram{Session: id},
+				})
+			}
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package services
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/config"
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/models"
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/repositories"
+)
+
+// connectAgent opens the persistent agent connection of a tunnel over a real
+// WebSocket and waits until the service uses it.
+func connectAgent(t *testing.T, svc *TunnelService, name string) (*websocket.Conn, *Tunnel) {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := svc.Connect(name, w, r); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ws.Close() })
+
+	svc.mux.RLock()
+	tunnel := svc.tunnels[name]
+	svc.mux.RUnlock()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for tunnel.currentMux() == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("agent connection was not attached")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return ws, tunnel
+}
+
+// readFrame returns the next frame of type want sent to the agent.
+func readFrame(t *testing.T, ws *websocket.Conn, want string, timeout time.Duration) *models.Frame {
+	t.Helper()
+	ws.SetReadDeadline(time.Now().Add(timeout))
+	defer ws.SetReadDeadline(time.Time{})
+
+	for {
+		var frame models.Frame
+		if err := ws.ReadJSON(&frame); err != nil {
+			t.Fatalf("waiting for a %s frame: %v", want, err)
+		}
+		if frame.Type == want {
+			return &frame
+		}
+	}
+}
+
+func registerUDP(t *testing.T, timeout int) (*TunnelService, *models.Tunnel) {
+	t.Helper()
+	config.LoadAppConfig()
+	config.AppConfig.UDP_PORT_MIN = 41000
+	config.AppConfig.UDP_PORT_MAX = 41999
+	config.AppConfig.UDP_SESSION_TIMEOUT = timeout
+
+	svc := NewTunnelService(nil, repositories.NewMemoryTunnelRepository(), nil)
+	registered, err := svc.Register("udp", models.TunnelOptions{Type: models.TunnelTypeUDP}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { svc.Close(registered.Name) })
+	return svc, registered
+}
+
+func dialPeer(t *testing.T, port int) *net.UDPConn {
+	t.Helper()
+	conn, err := net.DialUDP("udp", nil, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: port})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func readPeer(t *testing.T, conn *net.UDPConn) string {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, 64)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("peer %s got no reply: %v", conn.LocalAddr(), err)
+	}
+	return string(buf[:n])
+}
+
+func TestUDPTunnelMapsPeersToSessions(t *testing.T) {
+	svc, registered := registerUDP(t, 60)
+	ws, tunnel := connectAgent(t, svc, registered.Name)
+
+	alice := dialPeer(t, registered.Port)
+	bob := dialPeer(t, registered.Port)
+
+	// Cada datagrama espera o anterior chegar ao agente para manter a ordem
+	sessions := map[string]string{} // Remoto -> sessão
+	for _, step := range []struct {
+		peer *net.UDPConn
+		data string
+	}{{alice, "a1"}, {bob, "b1"}, {alice, "a2"}} {
+		if _, err := step.peer.Write([]byte(step.data)); err != nil {
+			t.Fatal(err)
+		}
+		frame := readFrame(t, ws, models.FrameDatagram, 2*time.Second)
+		datagram := frame.Datagram
+
+		if string(datagram.Data) != step.data {
+			t.Fatalf("agent got %q, want %q", datagram.Data, step.data)
+		}
+		if datagram.Remote != step.peer.LocalAddr().String() {
+			t.Errorf("remote = %s, want %s", datagram.Remote, step.peer.LocalAddr())
+		}
+		if id, seen := sessions[datagram.Remote]; seen && id != datagram.Session {
+			t.Errorf("peer %s moved from session %s to %s", datagram.Remote, id, datagram.Session)
+		}
+		sessions[datagram.Remote] = datagram.Session
+	}
+	if len(sessions) != 2 || sessions[alice.LocalAddr().String()] == sessions[bob.LocalAddr().String()] {
+		t.Fatalf("sessions = %v, want one per peer", sessions)
+	}
+
+	// As respostas do agente voltam só para o dono de cada sessão
+	for _, peer := range []*net.UDPConn{bob, alice} {
+		err := ws.WriteJSON(&models.Frame{
+			Type: models.FrameDatagram,
+			Datagram: &models.Datagram{
+				Session: sessions[peer.LocalAddr().String()],
+				Data:    []byte("reply to " + peer.LocalAddr().String()),
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := readPeer(t, peer), "reply to "+peer.LocalAddr().String(); got != want {
+			t.Errorf("peer got %q, want %q", got, want)
+		}
+	}
+
+	stats := tunnel.udp.stats()
+	if stats.Sessions != 2 || stats.PacketsIn != 3 || stats.PacketsOut != 2 || stats.BytesOut == 0 {
+		t.Errorf("stats = %+v, want 2 sessions, 3 packets in and 2 out", stats)
+	}
+
+	if err := svc.replyUDP(tunnel, &models.Datagram{Session: "unknown", Data: []byte("x")}); err == nil {
+		t.Error("replyUDP() to an unknown session succeeded")
+	}
+}
+
+func TestUDPTunnelExpiresIdleSessions(t *testing.T) {
+	svc, registered := registerUDP(t, 1)
+	ws, tunnel := connectAgent(t, svc, registered.Name)
+
+	peer := dialPeer(t, registered.Port)
+	if _, err := peer.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	session := readFrame(t, ws, models.FrameDatagram, 2*time.Second).Datagram.Session
+
+	// Sessão parada por mais de um segundo: o agente recebe session_close
+	closed := readFrame(t, ws, models.FrameSessionClose, 5*time.Second)
+	if closed.Datagram == nil || closed.Datagram.Session != session {
+		t.Fatalf("session_close = %+v, want session %s", closed.Datagram, session)
+	}
+	if stats := tunnel.udp.stats(); stats.Sessions != 0 {
+		t.Errorf("sessions after expiry = %d, want 0", stats.Sessions)
+	}
+	if err := svc.replyUDP(tunnel, &models.Datagram{Session: session, Data: []byte("late")}); err == nil {
+		t.Error("replyUDP() to an expired session succeeded")
+	}
+
+	// O mesmo peer volta com uma sessão nova
+	if _, err := peer.Write([]byte("again")); err != nil {
+		t.Fatal(err)
+	}
+	if again := readFrame(t, ws, models.FrameDatagram, 2*time.Second).Datagram.Session; again == session {
+		t.Error("expired session id was reused")
+	}
+}
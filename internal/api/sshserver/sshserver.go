@@ -0,0 +1,330 @@
+package sshserver
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/config"
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/logger"
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/models"
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/services"
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/utils"
+)
+
+// Payloads defined by RFC 4254, section 7.
+type forwardRequest struct {
+	BindAddr string
+	BindPort uint32
+}
+
+type forwardReply struct {
+	BindPort uint32
+}
+
+type forwardedChannel struct {
+	Addr       string
+	Port       uint32
+	OriginAddr string
+	OriginPort uint32
+}
+
+type server struct {
+	tunnelService *services.TunnelService
+	config        *ssh.ServerConfig
+}
+
+// session is one `ssh -R` client. Its tunnel is registered on the first
+// tcpip-forward request and closed together with the SSH connection.
+type session struct {
+	conn       *ssh.ServerConn
+	forward    forwardRequest
+	tunnel     *models.Tunnel
+	registered chan struct{}
+	once       sync.Once
+}
+
+func loadHostKey(path string) (ssh.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		return ssh.ParsePrivateKey(data)
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	block, err := ssh.MarshalPrivateKey(key, "tunnerse host key")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, pem.EncodeToMemory(block), 0o600); err != nil {
+		return nil, err
+	}
+
+	logger.Log("INFO", "SSH host key generated", []logger.LogDetail{{Key: "path", Value: path}})
+	return ssh.NewSignerFromKey(key)
+}
+
+func StartSSH(tunnelService *services.TunnelService) (<-chan error, error) {
+	hostKey, err := loadHostKey(config.AppConfig.SSH_HOST_KEY)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load ssh host key: %w", err)
+	}
+
+	listener, err := net.Listen("tcp", ":"+config.AppConfig.SSH_PORT)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen ssh: %w", err)
+	}
+
+	srv := newServer(tunnelService, hostKey)
+	errCh := make(chan error, 1)
+
+	logger.Log("INFO", "SSH frontend started", []logger.LogDetail{
+		{Key: "ssh", Value: ":" + config.AppConfig.SSH_PORT},
+	})
+
+	go func() {
+		errCh <- srv.serve(listener)
+	}()
+
+	return errCh, nil
+}
+
+func newServer(tunnelService *services.TunnelService, hostKey ssh.Signer) *server {
+	// Com api keys obrigatórias a chave é enviada como senha: ssh -R ... nome@host
+	sshConfig := &ssh.ServerConfig{
+		NoClientAuth: !config.AppConfig.API_KEY_REQUIRED,
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if config.AppConfig.API_KEY_REQUIRED {
+				return nil, fmt.Errorf("api key required")
+			}
+			return &ssh.Permissions{
+				Extensions: map[string]string{"fingerprint": ssh.FingerprintSHA256(key)},
+			}, nil
+		},
+		PasswordCallback: func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if _, err := tunnelService.Authenticate(context.Background(), string(password)); err != nil {
+				return nil, err
+			}
+			return &ssh.Permissions{
+				Extensions: map[string]string{"api_key": string(password)},
+			}, nil
+		},
+	}
+	sshConfig.AddHostKey(hostKey)
+
+	return &server{tunnelService: tunnelService, config: sshConfig}
+}
+
+// serve accepts SSH clients on listener until it fails.
+func (srv *server) serve(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return fmt.Errorf("ssh server error: %w", err)
+		}
+		go srv.handleConn(conn)
+	}
+}
+
+func (srv *server) handleConn(netConn net.Conn) {
+	conn, chans, reqs, err := ssh.NewServerConn(netConn, srv.config)
+	if err != nil {
+		logger.Log("DEBUG", "SSH handshake failed", []logger.LogDetail{{Key: "Error", Value: err.Error()}})
+		netConn.Close()
+		return
+	}
+	defer conn.Close()
+
+	sess := &session{conn: conn, registered: make(chan struct{})}
+	defer func() {
+		if sess.tunnel != nil {
+			srv.tunnelService.Close(sess.tunnel.Name)
+		}
+	}()
+
+	go srv.handleChannels(sess, chans)
+
+	for req := range reqs {
+		switch req.Type {
+		case "tcpip-forward":
+			srv.handleForward(sess, req)
+		case "cancel-tcpip-forward":
+			req.Reply(true, nil)
+			conn.Close()
+		default:
+			if req.WantReply {
+				req.Reply(false, nil)
+			}
+		}
+	}
+}
+
+func (srv *server) handleForward(sess *session, req *ssh.Request) {
+	var forward forwardRequest
+	if err := ssh.Unmarshal(req.Payload, &forward); err != nil || sess.tunnel != nil {
+		req.Reply(false, nil)
+		return
+	}
+
+	var apiKey *models.APIKey
+	if sess.conn.Permissions != nil {
+		key, err := srv.tunnelService.Authenticate(context.Background(), sess.conn.Permissions.Extensions["api_key"])
+		if err != nil {
+			req.Reply(false, nil)
+			return
+		}
+		apiKey = key
+	}
+
+	tunnel, err := srv.tunnelService.Register(sess.conn.User(), models.TunnelOptions{
+		Type:   models.TunnelTypeHTTP,
+		Stream: true,
+	}, apiKey)
+	if err != nil {
+		logger.Log("ERROR", "SSH registration failed", []logger.LogDetail{{Key: "Error", Value: err.Error()}})
+		req.Reply(false, nil)
+		return
+	}
+
+	sess.forward = forward
+	sess.tunnel = tunnel
+	sess.once.Do(func() { close(sess.registered) })
+
+	port := forward.BindPort
+	if port == 0 {
+		port = 80
+	}
+	req.Reply(true, ssh.Marshal(forwardReply{BindPort: port}))
+
+	logger.Log("INFO", "SSH tunnel registered", []logger.LogDetail{
+		{Key: "tunnel", Value: tunnel.Name},
+		{Key: "remote", Value: sess.conn.RemoteAddr().String()},
+	})
+
+	go srv.serveTunnel(sess)
+}
+
+// serveTunnel plays the agent role: every queued public request is relayed
+// over a new forwarded-tcpip channel, which the client connects to its local
+// port.
+func (srv *server) serveTunnel(sess *session) {
+	defer sess.conn.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		sess.conn.Wait()
+		cancel()
+	}()
+
+	for {
+		sreq, err := srv.tunnelService.Next(ctx, sess.tunnel.Name)
+		if err != nil {
+			return
+		}
+		go srv.forward(sess, sreq)
+	}
+}
+
+func (srv *server) forward(sess *session, sreq *models.SerializableRequest) {
+	// Sem o endereço do cliente a origem é o próprio servidor, já que clientes
+	// como o x/crypto/ssh recusam a porta 0
+	origin := sess.conn.LocalAddr().(*net.TCPAddr)
+	if addr, err := net.ResolveTCPAddr("tcp", sreq.Remote); err == nil && addr.IP != nil && addr.Port != 0 {
+		origin = addr
+	}
+
+	channel, reqs, err := sess.conn.OpenChannel("forwarded-tcpip", ssh.Marshal(forwardedChannel{
+		Addr:       sess.forward.BindAddr,
+		Port:       sess.forward.BindPort,
+		OriginAddr: origin.IP.String(),
+		OriginPort: uint32(origin.Port),
+	}))
+	if err != nil {
+		logger.Log("DEBUG", "SSH forwarded channel rejected", []logger.LogDetail{
+			{Key: "tunnel", Value: sess.tunnel.Name},
+			{Key: "Error", Value: err.Error()},
+		})
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+
+	if err := srv.tunnelService.Attach(sess.tunnel.Name, sreq.Token, channel); err != nil {
+		logger.Log("DEBUG", "SSH forwarded channel discarded", []logger.LogDetail{
+			{Key: "tunnel", Value: sess.tunnel.Name},
+			{Key: "Error", Value: err.Error()},
+		})
+	}
+}
+
+func (srv *server) handleChannels(sess *session, chans <-chan ssh.NewChannel) {
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "only session channels are accepted")
+			continue
+		}
+
+		channel, reqs, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+		go func() {
+			for req := range reqs {
+				switch req.Type {
+				case "shell", "pty-req", "env":
+					req.Reply(true, nil)
+				default:
+					req.Reply(false, nil)
+				}
+			}
+		}()
+		go srv.greet(sess, channel)
+	}
+}
+
+// greet prints the public URL once the forward is registered and keeps the
+// session open until the client hangs up.
+func (srv *server) greet(sess *session, channel ssh.Channel) {
+	defer channel.Close()
+
+	select {
+	case <-sess.registered:
+		fmt.Fprintf(channel, "Tunnerse tunnel is online\r\n\r\n  %s\r\n\r\nPress Ctrl+C to close the tunnel.\r\n", utils.TunnelURL(sess.tunnel.Name))
+	case <-time.After(10 * time.Second):
+		fmt.Fprintf(channel, "No remote forward requested. Usage: ssh -R 80:localhost:3000 <name>@%s\r\n", config.AppConfig.DOMAIN)
+		return
+	}
+
+	buf := make([]byte, 256)
+	for {
+		n, err := channel.Read(buf)
+		if err != nil {
+			return
+		}
+		for _, b := range buf[:n] {
+			// Ctrl+C ou Ctrl+D encerram a sessão
+			if b == 0x03 || b == 0x04 {
+				sess.conn.Close()
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package sshserver
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"crypto/rand"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/config"
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/repositories"
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/services"
+)
+
+// startTestServer runs the SSH frontend on a loopback port. With apiKeys the
+// clients must send a key as password.
+func startTestServer(t *testing.T, apiKeys repositories.APIKeyRepository) (*services.TunnelService, string) {
+	t.Helper()
+	config.LoadAppConfig()
+	config.AppConfig.SUBDOMAIN = false
+	config.AppConfig.API_KEY_REQUIRED = apiKeys != nil
+	config.AppConfig.TUNNEL_REQUEST_TIMEOUT = 5
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostKey, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	svc := services.NewTunnelService(apiKeys, repositories.NewMemoryTunnelRepository(), nil)
+	go newServer(svc, hostKey).serve(listener)
+	return svc, listener.Addr().String()
+}
+
+func dialSSH(t *testing.T, addr, user, password string) *ssh.Client {
+	t.Helper()
+	client, err := ssh.Dial("tcp", addr, &ssh.ClientConfig{
+		User:            user,
+		Auth:            []ssh.AuthMethod{ssh.Password(password)},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         5 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// tunnelName reads the public URL printed on the session channel, like the
+// user sees after `ssh -R`.
+func tunnelName(t *testing.T, client *ssh.Client) string {
+	t.Helper()
+	session, err := client.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { session.Close() })
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := session.Shell(); err != nil {
+		t.Fatal(err)
+	}
+
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); strings.HasPrefix(line, "https://") {
+			return strings.Trim(line[strings.LastIndex(strings.TrimSuffix(line, "/"), "/"):], "/")
+		}
+	}
+	t.Fatalf("no tunnel URL printed: %v", scanner.Err())
+	return ""
+}
+
+// publicRequest sends r through the tunnel as a client reaching the public URL.
+func publicRequest(svc *services.TunnelService, name, clientIP string, r *http.Request) (*httptest.ResponseRecorder, <-chan error) {
+	w := httptest.NewRecorder()
+	done := make(chan error, 1)
+	go func() { done <- svc.Tunnel(name, r.URL.Path, clientIP, w, r) }()
+	return w, done
+}
+
+func TestForwardRelaysRequestWithClientOrigin(t *testing.T) {
+	svc, addr := startTestServer(t, nil)
+	client := dialSSH(t, addr, "demo", "")
+
+	local, err := client.Listen("tcp", "0.0.0.0:80")
+	if err != nil {
+		t.Fatalf("tcpip-forward rejected: %v", err)
+	}
+	name := tunnelName(t, client)
+	if !strings.HasPrefix(name, "demo-") {
+		t.Fatalf("tunnel name = %q, want it based on the ssh user", name)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		clientIP   string
+		xff        string
+		origin     string
+	}{
+		{name: "direct client", remoteAddr: "203.0.113.7:4567", clientIP: "203.0.113.7", origin: "203.0.113.7:4567"},
+		{name: "behind a trusted proxy", remoteAddr: "10.0.0.2:5120", clientIP: "198.51.100.4", xff: "198.51.100.4", origin: "198.51.100.4:5120"},
+		{name: "spoofed forwarded for", remoteAddr: "203.0.113.9:1000", clientIP: "203.0.113.9", xff: "192.0.2.1:22", origin: "203.0.113.9:1000"},
+		{name: "ipv6 client", remoteAddr: "[2001:db8::1]:443", clientIP: "2001:db8::1", origin: "[2001:db8::1]:443"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/"+name+"/hello?x=1", nil)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.xff != "" {
+				r.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			w, done := publicRequest(svc, name, tt.clientIP, r)
+
+			// Cada requisição chega como um canal forwarded-tcpip novo
+			conn, err := local.Accept()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			if got := conn.RemoteAddr().String(); got != tt.origin {
+				t.Errorf("channel origin = %s, want %s", got, tt.origin)
+			}
+
+			req, err := http.ReadRequest(bufio.NewReader(conn))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if req.URL.RequestURI() != "/hello?x=1" {
+				t.Errorf("local app got %s, want /hello?x=1", req.URL.RequestURI())
+			}
+			io.WriteString(conn, "HTTP/1.1 200 OK\r\nContent-Length: 2\r\nConnection: close\r\n\r\nok")
+			conn.Close()
+
+			if err := <-done; err != nil {
+				t.Fatal(err)
+			}
+			if w.Code != http.StatusOK || w.Body.String() != "ok" {
+				t.Errorf("public response = %d %q, want 200 ok", w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandleForwardRejects(t *testing.T) {
+	svc, addr := startTestServer(t, nil)
+
+	t.Run("second forward on the same connection", func(t *testing.T) {
+		client := dialSSH(t, addr, "demo", "")
+		if _, err := client.Listen("tcp", "0.0.0.0:80"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := client.Listen("tcp", "0.0.0.0:8080"); err == nil {
+			t.Error("second tcpip-forward was accepted")
+		}
+	})
+
+	t.Run("tunnel closes with the connection", func(t *testing.T) {
+		client := dialSSH(t, addr, "demo", "")
+		if _, err := client.Listen("tcp", "0.0.0.0:80"); err != nil {
+			t.Fatal(err)
+		}
+		name := tunnelName(t, client)
+		client.Close()
+
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			if _, err := svc.Stats(name); err != nil {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("tunnel still open after the ssh connection closed")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+}
+
+func TestHandleForwardAPIKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	keys := `[
+		{"name": "team", "key": "team-key", "allowed_prefixes": ["team", "shared"]},
+		{"name": "ops", "key": "ops-key", "reserved_names": ["shared"]}
+	]`
+	if err := os.WriteFile(path, []byte(keys), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	apiKeys, err := repositories.NewFileAPIKeyRepository(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, addr := startTestServer(t, apiKeys)
+
+	tests := []struct {
+		name     string
+		user     string
+		password string
+		accepted bool
+	}{
+		{name: "allowed prefix", user: "team", password: "team-key", accepted: true},
+		{name: "name outside the key prefixes", user: "other", password: "team-key"},
+		{name: "name reserved by another key", user: "shared", password: "team-key"},
+		{name: "reserved name of the key", user: "shared", password: "ops-key", accepted: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := dialSSH(t, addr, tt.user, tt.password)
+			_, err := client.Listen("tcp", "0.0.0.0:80")
+			if accepted := err == nil; accepted != tt.accepted {
+				t.Errorf("tcpip-forward accepted = %v, want %v (err %v)", accepted, tt.accepted, err)
+			}
+		})
+	}
+
+	if _, err := ssh.Dial("tcp", addr, &ssh.ClientConfig{
+		User:            "team",
+		Auth:            []ssh.AuthMethod{ssh.Password("wrong")},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	}); err == nil {
+		t.Error("handshake with an unknown key succeeded")
+	}
+}
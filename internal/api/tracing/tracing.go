@@ -0,0 +1,140 @@
+// Package tracing propagates W3C Trace Context through the tunnel and exports
+// the server spans to an OTLP/HTTP collector with OpenTelemetry.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+const (
+	TraceparentHeader = "Traceparent"
+	TracestateHeader  = "Tracestate"
+
+	scopeName = "github.com/pedroborgesdev/tunnerse-api"
+)
+
+type Options struct {
+	Endpoint    string            // URL completa do coletor, ex: http://localhost:4318/v1/traces
+	Headers     map[string]string // Enviados em cada exportação, ex: autenticação
+	ServiceName string
+	SampleRatio float64 // Fração dos traces novos exportados, de 0 a 1
+}
+
+var (
+	propagator = propagation.TraceContext{}
+
+	active   *sdktrace.TracerProvider
+	activeMu sync.RWMutex
+)
+
+// Setup starts exporting spans in batches. New traces are sampled at
+// SampleRatio; traces started upstream follow the sampled flag of their
+// parent. A previous setup is shut down.
+func Setup(opts Options) error {
+	if opts.Endpoint == "" {
+		return fmt.Errorf("tracing endpoint is required")
+	}
+	if opts.ServiceName == "" {
+		opts.ServiceName = "tunnerse-api"
+	}
+
+	exporter, err := otlptracehttp.New(context.Background(),
+		otlptracehttp.WithEndpointURL(opts.Endpoint),
+		otlptracehttp.WithHeaders(opts.Headers),
+		otlptracehttp.WithTimeout(10*time.Second),
+	)
+	if err != nil {
+		return fmt.Errorf("invalid tracing endpoint: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", opts.ServiceName))),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(opts.SampleRatio))),
+	)
+
+	activeMu.Lock()
+	previous := active
+	active = provider
+	activeMu.Unlock()
+
+	if previous != nil {
+		previous.Shutdown(context.Background())
+	}
+	return nil
+}
+
+// Enabled reports whether spans are being exported.
+func Enabled() bool {
+	activeMu.RLock()
+	defer activeMu.RUnlock()
+	return active != nil
+}
+
+// Shutdown sends the pending spans and stops exporting. It waits for the
+// last export until ctx is done.
+func Shutdown(ctx context.Context) error {
+	activeMu.Lock()
+	provider := active
+	active = nil
+	activeMu.Unlock()
+
+	if provider == nil {
+		return nil
+	}
+	return provider.Shutdown(ctx)
+}
+
+// Tracer returns the tracer of the server spans, a no-op one while tracing is
+// off.
+func Tracer() trace.Tracer {
+	activeMu.RLock()
+	defer activeMu.RUnlock()
+	if active == nil {
+		return noop.NewTracerProvider().Tracer(scopeName)
+	}
+	return active.Tracer(scopeName)
+}
+
+// Extract returns ctx with the trace context of an incoming request. A
+// missing or malformed traceparent leaves ctx as it is, so a new trace is
+// started.
+func Extract(ctx context.Context, h http.Header) context.Context {
+	return propagator.Extract(ctx, propagation.HeaderCarrier(h))
+}
+
+// Inject writes the span context of ctx into h, replacing any previous trace
+// headers.
+func Inject(ctx context.Context, h http.Header) {
+	h.Del(TraceparentHeader)
+	h.Del(TracestateHeader)
+	propagator.Inject(ctx, propagation.HeaderCarrier(h))
+}
+
+// ParseHeaders reads "key=value,key2=value2", the format of
+// OTEL_EXPORTER_OTLP_HEADERS.
+func ParseHeaders(value string) map[string]string {
+	headers := map[string]string{}
+	for _, pair := range strings.Split(value, ",") {
+		key, val, ok := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			continue
+		}
+		headers[key] = strings.TrimSpace(val)
+	}
+	return headers
+}
@@ -0,0 +1,270 @@
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// collector is an OTLP/HTTP endpoint that keeps every decoded request.
+type collector struct {
+	server   *httptest.Server
+	mu       sync.Mutex
+	requests []*coltracepb.ExportTraceServiceRequest
+	headers  []http.Header
+}
+
+func newCollector(t *testing.T) *collector {
+	t.Helper()
+	c := &collector{}
+	c.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v1/traces" {
+			http.NotFound(w, r)
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		payload := &coltracepb.ExportTraceServiceRequest{}
+		if err := proto.Unmarshal(body, payload); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		c.mu.Lock()
+		c.requests = append(c.requests, payload)
+		c.headers = append(c.headers, r.Header.Clone())
+		c.mu.Unlock()
+		w.Header().Set("Content-Type", "application/x-protobuf")
+	}))
+	t.Cleanup(c.server.Close)
+	return c
+}
+
+// spans returns every exported span by name, with the resource attributes of
+// the last request.
+func (c *collector) spans() (map[string]*tracepb.Span, []*commonpb.KeyValue) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	spans := map[string]*tracepb.Span{}
+	var resource []*commonpb.KeyValue
+	for _, request := range c.requests {
+		for _, rs := range request.ResourceSpans {
+			resource = rs.Resource.GetAttributes()
+			for _, ss := range rs.ScopeSpans {
+				for _, span := range ss.Spans {
+					spans[span.Name] = span
+				}
+			}
+		}
+	}
+	return spans, resource
+}
+
+func setupCollector(t *testing.T, ratio float64) *collector {
+	t.Helper()
+	c := newCollector(t)
+	err := Setup(Options{
+		Endpoint:    c.server.URL + "/v1/traces",
+		Headers:     map[string]string{"Authorization": "Bearer otlp"},
+		ServiceName: "tunnerse-test",
+		SampleRatio: ratio,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func shutdown(t *testing.T) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func attributeMap(attrs []*commonpb.KeyValue) map[string]*commonpb.AnyValue {
+	m := make(map[string]*commonpb.AnyValue, len(attrs))
+	for _, attr := range attrs {
+		m[attr.Key] = attr.Value
+	}
+	return m
+}
+
+func TestExporterSendsSpans(t *testing.T) {
+	c := setupCollector(t, 1)
+
+	h := http.Header{}
+	h.Set(TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	h.Set(TracestateHeader, "vendor=1")
+	ctx := Extract(context.Background(), h)
+	if !trace.SpanContextFromContext(ctx).IsRemote() {
+		t.Fatal("Extract() rejected a valid traceparent")
+	}
+
+	start := time.Unix(1700000000, 0)
+	ctx, server := Tracer().Start(ctx, "tunnel GET",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithTimestamp(start),
+		trace.WithAttributes(
+			attribute.String("tunnerse.tunnel", "demo"),
+			attribute.Int("http.response.status_code", 502),
+			attribute.Bool("tunnerse.replay", true),
+			attribute.Float64("ratio", 0.5),
+		),
+	)
+	_, client := Tracer().Start(ctx, "tunnel agent",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithTimestamp(start.Add(time.Millisecond)),
+	)
+	client.SetStatus(codes.Error, "local-api-error")
+	client.End(trace.WithTimestamp(start.Add(2 * time.Millisecond)))
+	server.End(trace.WithTimestamp(start.Add(3 * time.Millisecond)))
+
+	shutdown(t)
+
+	spans, resource := c.spans()
+	if len(spans) != 2 {
+		t.Fatalf("exported %d spans, want 2", len(spans))
+	}
+	if got := attributeMap(resource)["service.name"].GetStringValue(); got != "tunnerse-test" {
+		t.Errorf("service.name = %q, want tunnerse-test", got)
+	}
+	if got := c.headers[0].Get("Authorization"); got != "Bearer otlp" {
+		t.Errorf("Authorization = %q, want the configured header", got)
+	}
+
+	s, a := spans["tunnel GET"], spans["tunnel agent"]
+
+	if hex.EncodeToString(s.TraceId) != "4bf92f3577b34da6a3ce929d0e0e4736" || hex.EncodeToString(a.TraceId) != hex.EncodeToString(s.TraceId) {
+		t.Errorf("trace ids = %x, %x; want the incoming trace", s.TraceId, a.TraceId)
+	}
+	if hex.EncodeToString(s.ParentSpanId) != "00f067aa0ba902b7" {
+		t.Errorf("server parent = %x, want the incoming span", s.ParentSpanId)
+	}
+	if hex.EncodeToString(a.ParentSpanId) != hex.EncodeToString(s.SpanId) || len(s.SpanId) == 0 || hex.EncodeToString(a.SpanId) == hex.EncodeToString(s.SpanId) {
+		t.Errorf("agent parent = %x, server span = %x, agent span = %x", a.ParentSpanId, s.SpanId, a.SpanId)
+	}
+	if s.TraceState != "vendor=1" {
+		t.Errorf("tracestate = %q, want vendor=1", s.TraceState)
+	}
+	if s.Kind != tracepb.Span_SPAN_KIND_SERVER || a.Kind != tracepb.Span_SPAN_KIND_CLIENT {
+		t.Errorf("kinds = %v, %v", s.Kind, a.Kind)
+	}
+
+	if s.StartTimeUnixNano != 1700000000000000000 || s.EndTimeUnixNano != 1700000000003000000 {
+		t.Errorf("server times = %d..%d", s.StartTimeUnixNano, s.EndTimeUnixNano)
+	}
+	if a.StartTimeUnixNano != 1700000000001000000 {
+		t.Errorf("agent start = %d", a.StartTimeUnixNano)
+	}
+
+	attrs := attributeMap(s.Attributes)
+	if v := attrs["tunnerse.tunnel"].GetStringValue(); v != "demo" {
+		t.Errorf("tunnerse.tunnel = %q", v)
+	}
+	if v := attrs["http.response.status_code"].GetIntValue(); v != 502 {
+		t.Errorf("status code = %d", v)
+	}
+	if v := attrs["tunnerse.replay"].GetBoolValue(); !v {
+		t.Errorf("tunnerse.replay = %v", v)
+	}
+	if v := attrs["ratio"].GetDoubleValue(); v != 0.5 {
+		t.Errorf("ratio = %v", v)
+	}
+
+	if s.Status.GetCode() != tracepb.Status_STATUS_CODE_UNSET {
+		t.Errorf("server status = %v, want unset", s.Status)
+	}
+	if a.Status.GetCode() != tracepb.Status_STATUS_CODE_ERROR || a.Status.GetMessage() != "local-api-error" {
+		t.Errorf("agent status = %v, want error", a.Status)
+	}
+}
+
+func TestSamplerFollowsParent(t *testing.T) {
+	c := setupCollector(t, 0)
+
+	// Taxa zero descarta traces novos, mas o flag do pai decide os demais
+	tests := []struct {
+		name        string
+		traceparent string
+	}{
+		{name: "new"},
+		{name: "unsampled parent", traceparent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00"},
+		{name: "sampled parent", traceparent: "00-4bf92f3577b34da6a3ce929d0e0e4737-00f067aa0ba902b7-01"},
+	}
+	for _, tt := range tests {
+		ctx := Extract(context.Background(), http.Header{TraceparentHeader: {tt.traceparent}})
+		_, span := Tracer().Start(ctx, tt.name)
+		span.End()
+	}
+
+	shutdown(t)
+
+	spans, _ := c.spans()
+	if len(spans) != 1 || spans["sampled parent"] == nil {
+		t.Errorf("exported %v, want only the span of the sampled parent", spans)
+	}
+}
+
+func TestInjectReplacesTraceHeaders(t *testing.T) {
+	setupCollector(t, 1)
+	defer shutdown(t)
+
+	incoming := http.Header{}
+	incoming.Set(TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	incoming.Set(TracestateHeader, "vendor=1")
+	ctx, span := Tracer().Start(Extract(context.Background(), incoming), "tunnel agent")
+	defer span.End()
+
+	// O cliente pode mandar cabeçalhos próprios, que não seguem para o app
+	h := http.Header{}
+	h.Set(TraceparentHeader, "00-11111111111111111111111111111111-2222222222222222-01")
+	h.Set(TracestateHeader, "client=1")
+	Inject(ctx, h)
+
+	want := "00-4bf92f3577b34da6a3ce929d0e0e4736-" + span.SpanContext().SpanID().String() + "-01"
+	if got := h.Values(TraceparentHeader); len(got) != 1 || got[0] != want {
+		t.Errorf("traceparent = %v, want [%s]", got, want)
+	}
+	if got := h.Values(TracestateHeader); len(got) != 1 || got[0] != "vendor=1" {
+		t.Errorf("tracestate = %v, want [vendor=1]", got)
+	}
+}
+
+func TestShutdownSendsPendingSpans(t *testing.T) {
+	c := setupCollector(t, 1)
+
+	// Menos que um lote e antes do intervalo do batcher: só o Shutdown envia
+	for i := 0; i < 3; i++ {
+		_, span := Tracer().Start(context.Background(), "pending")
+		span.End()
+	}
+	shutdown(t)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.requests) != 1 || len(c.requests[0].ResourceSpans[0].ScopeSpans[0].Spans) != 3 {
+		t.Fatalf("collector got %d requests, want one with 3 spans", len(c.requests))
+	}
+	if Enabled() {
+		t.Error("still enabled after Shutdown")
+	}
+}
@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// BearerToken extracts the credential of an "Authorization: Bearer" header.
+func BearerToken(ctx *gin.Context) string {
+	header := ctx.GetHeader("Authorization")
+	if len(header) < 7 || !strings.EqualFold(header[:7], "bearer ") {
+		return ""
+	}
+	return strings.TrimSpace(header[7:])
+}
+
+// NewSecret returns a random hex secret with the given number of bytes of
+// entropy.
+func NewSecret(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+func HashSecret(secret string) []byte {
+	sum := sha256.Sum256([]byte(secret))
+	return sum[:]
+}
+
+// HashPassword hashes a password chosen by a user with bcrypt. Unlike the
+// random secrets given to HashSecret, passwords can be guessed, so they get a
+// salt and a slow hash.
+func HashPassword(password string) ([]byte, error) {
+	return bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+}
+
+// MatchPassword reports whether password matches a hash from HashPassword.
+func MatchPassword(password string, hash []byte) bool {
+	if password == "" || len(hash) == 0 {
+		return false
+	}
+	return bcrypt.CompareHashAndPassword(hash, []byte(password)) == nil
+}
+
+// MatchSecret compares a presented secret against a stored hash in constant
+// time.
+func MatchSecret(secret string, hash []byte) bool {
+	if secret == "" || len(hash) == 0 {
+		return false
+	}
+	return subtle.ConstantTimeCompare(HashSecret(secret), hash) == 1
+}
@@ -1,5 +1,17 @@
 package utils
 
 type RegisterRequest struct {
-	Name string `json:"name" binding:"required"`
+	Name   string `json:"name" binding:"required"`
+	Type   string `json:"type" binding:"omitempty,oneof=http tcp udp"`
+	Stream bool   `json:"stream"`
+
+	Auth  *PublicAuthRequest `json:"auth"`
+	Allow []string           `json:"allow"` // IPs ou CIDRs liberados
+	Deny  []string           `json:"deny"`  // IPs ou CIDRs bloqueados
+}
+
+type PublicAuthRequest struct {
+	Username string `json:"username" binding:"required_with=Password"`
+	Password string `json:"password" binding:"required_with=Username"`
+	Token    string `json:"token"`
 }
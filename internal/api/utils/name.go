@@ -9,12 +9,18 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// GetTunnelName resolves the tunnel a request is addressed to: the first label
+// of the host in subdomain mode, the first path segment otherwise.
 func GetTunnelName(ctx *gin.Context) string {
 	name := ""
 	host := ctx.Request.Host
 
 	if !config.AppConfig.SUBDOMAIN {
 		name = ctx.Param("name")
+		// No NoRoute o gin só preenche :name quando o método tem alguma rota com ele
+		if name == "" {
+			name, _, _ = strings.Cut(strings.TrimPrefix(ctx.Request.URL.Path, "/"), "/")
+		}
 	} else {
 		if h, _, err := net.SplitHostPort(host); err == nil {
 			host = h
@@ -28,3 +34,11 @@ func GetTunnelName(ctx *gin.Context) string {
 
 	return name
 }
+
+// TunnelURL returns the public address of a tunnel for the configured mode.
+func TunnelURL(name string) string {
+	if config.AppConfig.SUBDOMAIN {
+		return "https://" + name + "." + config.AppConfig.DOMAIN
+	}
+	return "https://" + config.AppConfig.DOMAIN + "/" + name + "/"
+}
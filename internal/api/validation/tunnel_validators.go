@@ -3,10 +3,20 @@ package validation
 import (
 	"errors"
 	"regexp"
+	"strings"
+
+	"github.com/pedroborgesdev/tunnerse-api/internal/api/models"
 )
 
 var (
-	ErrBannedName = errors.New("tunnel name contais inavalid characters")
+	ErrBannedName     = errors.New("tunnel name contais inavalid characters")
+	ErrNameNotAllowed = errors.New("tunnel name is not allowed for this api key")
+	ErrTunnelLimit    = errors.New("tunnel limit reached for this api key")
+	ErrAPIKeyRequired = errors.New("missing api key")
+	ErrAPIKeyInvalid  = errors.New("invalid api key")
+	ErrAuthEmpty      = errors.New("auth requires a username and password or a token")
+	ErrAuthType       = errors.New("auth is only supported on http tunnels")
+	ErrInvalidCIDR    = errors.New("invalid ip or cidr")
 )
 
 type TunnelValidator struct {
@@ -22,3 +32,28 @@ func NewTunnelValidator() *TunnelValidator {
 func (v *TunnelValidator) ValidateTunnelRegister(name string) error {
 	return nil
 }
+
+func (v *TunnelValidator) ValidateAllowedPrefix(name string, prefixes []string) error {
+	if len(prefixes) == 0 {
+		return nil
+	}
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(name, prefix) {
+			return nil
+		}
+	}
+	return ErrNameNotAllowed
+}
+
+func (v *TunnelValidator) ValidatePublicAuth(tunnelType string, auth *models.TunnelAuth) error {
+	if auth == nil {
+		return nil
+	}
+	if len(auth.PasswordHash) == 0 && len(auth.TokenHash) == 0 {
+		return ErrAuthEmpty
+	}
+	if tunnelType != models.TunnelTypeHTTP {
+		return ErrAuthType
+	}
+	return nil
+}
@@ -52,6 +52,14 @@ else
     echo "  Warning: tunnerse.config not found"
 fi
 
+if [ -f "apikeys.json" ]; then
+    echo "  Copying apikeys.json..."
+    cp apikeys.json /usr/local/bin/
+fi
+
+echo "  Creating data/ directory..."
+mkdir -p /usr/local/bin/data
+
 if [ -f ".env" ]; then
     echo "  Copying .env..."
     cp .env /usr/local/bin/
@@ -64,6 +72,8 @@ chown -R $REAL_USER:$REAL_USER /usr/local/bin/certs 2>/dev/null || true
 chown -R $REAL_USER:$REAL_USER /usr/local/bin/static 2>/dev/null || true
 chown $REAL_USER:$REAL_USER /usr/local/bin/tunnerse.config 2>/dev/null || true
 chown $REAL_USER:$REAL_USER /usr/local/bin/.env 2>/dev/null || true
+chown $REAL_USER:$REAL_USER /usr/local/bin/apikeys.json 2>/dev/null || true
+chown -R $REAL_USER:$REAL_USER /usr/local/bin/data 2>/dev/null || true
 
 echo "Installing systemd service..."
 
@@ -103,6 +113,7 @@ echo "  - Binary: /usr/local/bin/tunnerse-api"
 echo "  - Static: /usr/local/bin/static/"
 echo "  - Config: /usr/local/bin/tunnerse.config"
 echo "  - Env:    /usr/local/bin/.env"
+echo "  - Data:   /usr/local/bin/data/"
 echo ""
 echo "To manage the service:"
 echo "  sudo systemctl enable tunnerse-api    # Enable on boot"